@@ -0,0 +1,151 @@
+package blob
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/timgluz/blobber/pkg/blobstore"
+	"github.com/timgluz/blobber/pkg/response"
+	"github.com/timgluz/blobber/pkg/secret"
+)
+
+// Actions on a blob are addressed as POST /blobs/{key}:{action}.
+const (
+	actionCopy    = "copy"
+	actionMove    = "move"
+	actionPresign = "presign"
+	actionShare   = "share"
+)
+
+// maxActionBodySize limits the JSON body of blob actions.
+const maxActionBodySize = 64 << 10
+
+type copyRequest struct {
+	Destination string `json:"destination"`
+}
+
+// splitAction splits a path like "docs/a.txt:copy" into the key and a known
+// action. Paths without a known action suffix are plain keys.
+func splitAction(path string) (key, action string, ok bool) {
+	i := strings.LastIndex(path, ":")
+	if i < 0 {
+		return path, "", false
+	}
+
+	switch path[i+1:] {
+	case actionCopy, actionMove, actionPresign, actionShare:
+		return path[:i], path[i+1:], true
+	default:
+		return path, "", false
+	}
+}
+
+// postBlob runs a blob action, stores the files of an upload form below the
+// path, or stores the blob like PUT.
+func (h *Handler) postBlob(w http.ResponseWriter, r *http.Request) {
+	rawKey, action, ok := splitAction(r.PathValue("key"))
+	if !ok {
+		if isFormUpload(r) {
+			h.uploadForm(w, r, r.PathValue("key"))
+			return
+		}
+
+		h.putBlob(w, r)
+		return
+	}
+
+	key, err := parseKey(rawKey)
+	if err != nil {
+		response.RenderErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case actionCopy:
+		h.copyBlob(w, r, key, false)
+	case actionMove:
+		h.copyBlob(w, r, key, true)
+	case actionPresign:
+		h.presignBlob(w, r, key)
+	case actionShare:
+		h.shareBlob(w, r, key)
+	}
+}
+
+// copyBlob copies a blob server-side. A move deletes the source afterwards,
+// unless it was changed while it was being copied.
+func (h *Handler) copyBlob(w http.ResponseWriter, r *http.Request, src string, move bool) {
+	var req copyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxActionBodySize)).Decode(&req); err != nil {
+		response.RenderErrorJSON(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	dst, err := parseKey(req.Destination)
+	if err != nil {
+		response.RenderErrorJSON(w, "Invalid destination: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if dst == src {
+		response.RenderErrorJSON(w, "Destination must differ from the source", http.StatusBadRequest)
+		return
+	}
+
+	// a move must not leave a copy behind when the source cannot be deleted
+	if move && !secret.Allowed(r.Context(), secret.OpDelete, src) {
+		h.renderActionError(w, src, "Failed to move blob", secret.ErrForbidden)
+		return
+	}
+
+	info, err := h.store.Stat(r.Context(), src)
+	if err != nil {
+		h.renderActionError(w, src, "Failed to copy blob", err)
+		return
+	}
+
+	h.logger.Debug("Copying blob", slog.String("src", src), slog.String("dst", dst), slog.Bool("move", move))
+	if err := h.store.Copy(r.Context(), src, dst); err != nil {
+		h.renderActionError(w, src, "Failed to copy blob", err)
+		return
+	}
+
+	if !move {
+		response.RenderSuccessJSON(w, "Blob copied successfully", http.StatusCreated)
+		return
+	}
+
+	err = h.store.DeleteWithOptions(r.Context(), src, blobstore.DeleteOptions{IfMatch: info.ETag})
+	if errors.Is(err, blobstore.ErrPreconditionNotSupported) {
+		// the store cannot guard the delete, so changes during the move are lost
+		err = h.store.Delete(r.Context(), src)
+	}
+	if errors.Is(err, blobstore.ErrPreconditionFailed) || errors.Is(err, blobstore.ErrBlobNotFound) {
+		response.RenderErrorJSON(w, "Source blob changed during the move; it was copied but not deleted", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.renderActionError(w, src, "Failed to delete the source blob", err)
+		return
+	}
+
+	h.logger.Info("Blob moved", slog.String("src", src), slog.String("dst", dst))
+	response.RenderSuccessJSON(w, "Blob moved successfully", http.StatusCreated)
+}
+
+func (h *Handler) renderActionError(w http.ResponseWriter, key, message string, err error) {
+	switch {
+	case errors.Is(err, blobstore.ErrBlobNotFound):
+		response.RenderErrorJSON(w, "Blob not found", http.StatusNotFound)
+	case errors.Is(err, blobstore.ErrInvalidKey):
+		response.RenderErrorJSON(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, secret.ErrForbidden):
+		response.RenderErrorJSON(w, "Forbidden", http.StatusForbidden)
+	default:
+		h.logger.Error(message, slog.String("key", key), slog.String("error", err.Error()))
+		response.RenderErrorJSON(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,171 @@
+package blob
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/timgluz/blobber/pkg/blobstore"
+	"github.com/timgluz/blobber/pkg/response"
+	"github.com/timgluz/blobber/pkg/secret"
+)
+
+// Archive formats supported by GET /blobs?archive=.
+const (
+	archiveZip   = "zip"
+	archiveTarGz = "tar.gz"
+)
+
+// archiveWriter adds blobs to an archive that is streamed to the client.
+type archiveWriter interface {
+	add(name string, info blobstore.BlobInfo, r io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) add(name string, info blobstore.BlobInfo, r io.Reader) error {
+	entry, err := a.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: info.LastModified,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, r)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+type tarGzArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (a *tarGzArchive) add(name string, info blobstore.BlobInfo, r io.Reader) error {
+	err := a.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0o644,
+		Size:     info.Size,
+		ModTime:  info.LastModified,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the header announced the listed size, so the entry must be exactly that long
+	_, err = io.CopyN(a.tw, r, info.Size)
+	return err
+}
+
+func (a *tarGzArchive) Close() error {
+	return errors.Join(a.tw.Close(), a.gz.Close())
+}
+
+// archiveBlobs streams an archive of every blob under the prefix. Entries are
+// added while the blobs are listed, so nothing but the current page is held in
+// memory. Entry names are relative to the last "/" of the prefix.
+func (h *Handler) archiveBlobs(w http.ResponseWriter, r *http.Request, prefix, format string) {
+	if prefix == "" {
+		response.RenderErrorJSON(w, "prefix is required for archives", http.StatusBadRequest)
+		return
+	}
+
+	var archive archiveWriter
+	var contentType string
+	switch format {
+	case archiveZip:
+		archive, contentType = &zipArchive{zw: zip.NewWriter(w)}, "application/zip"
+	case archiveTarGz:
+		gz := gzip.NewWriter(w)
+		archive, contentType = &tarGzArchive{gz: gz, tw: tar.NewWriter(gz)}, "application/gzip"
+	default:
+		response.RenderErrorJSON(w, "archive must be zip or tar.gz", http.StatusBadRequest)
+		return
+	}
+
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+	name := path.Base(strings.TrimSuffix(prefix, "/"))
+
+	// nothing is written until the first page is listed, so listing errors can
+	// still be reported properly
+	// the archive headers need the size and modification time of every blob
+	opts := blobstore.ListOptions{Prefix: prefix, Limit: blobstore.MaxListLimit, Details: true}
+	page, err := h.store.ListPage(r.Context(), opts)
+	if err != nil {
+		if errors.Is(err, secret.ErrForbidden) {
+			response.RenderErrorJSON(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		h.logger.Error("failed to list blobs", slog.String("prefix", prefix), slog.String("error", err.Error()))
+		response.RenderErrorJSON(w, "Failed to list blobs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", attachmentDisposition(name+"."+format))
+	w.WriteHeader(http.StatusOK)
+
+	h.logger.Info("Streaming archive", slog.String("prefix", prefix), slog.String("format", format))
+	for {
+		for _, info := range page.Items {
+			// listable blobs the token cannot read are left out
+			if !secret.Allowed(r.Context(), secret.OpRead, info.Key) {
+				continue
+			}
+
+			if err := h.addToArchive(r, archive, strings.TrimPrefix(info.Key, dir), info); err != nil {
+				h.abortArchive(prefix, err)
+			}
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+
+		opts.Cursor = page.NextCursor
+		if page, err = h.store.ListPage(r.Context(), opts); err != nil {
+			h.abortArchive(prefix, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		h.abortArchive(prefix, err)
+	}
+}
+
+// addToArchive adds a single blob; blobs deleted since they were listed are skipped.
+func (h *Handler) addToArchive(r *http.Request, archive archiveWriter, name string, info blobstore.BlobInfo) error {
+	reader, err := h.store.GetReader(r.Context(), info.Key)
+	if errors.Is(err, blobstore.ErrBlobNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return archive.add(name, info, reader)
+}
+
+// abortArchive cuts the connection, as the status has already been sent and a
+// truncated archive must not look complete to the client.
+func (h *Handler) abortArchive(prefix string, err error) {
+	h.logger.Error("Failed to stream archive", slog.String("prefix", prefix), slog.String("error", err.Error()))
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,164 @@
+package blob
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/timgluz/blobber/pkg/blobstore"
+	"github.com/timgluz/blobber/pkg/response"
+	"github.com/timgluz/blobber/pkg/secret"
+)
+
+// maxBatchBodySize fits MaxDeleteBatch keys of the maximum length.
+const maxBatchBodySize = 2 << 20
+
+// BatchDeleteRequest is the body of POST /blobs:batchDelete.
+type BatchDeleteRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// BatchDeleteResult is the outcome of deleting a single key.
+type BatchDeleteResult struct {
+	Key     string `json:"key"`
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BatchDeleteResponse reports the outcome of a batch or prefix delete.
+type BatchDeleteResponse struct {
+	Deleted int                 `json:"deleted"`
+	Failed  int                 `json:"failed"`
+	Results []BatchDeleteResult `json:"results"`
+	// Error is set when a prefix delete stopped after deleting some blobs.
+	Error string `json:"error,omitempty"`
+}
+
+// addDeleteResults adds the results of a DeleteMany call to the response. The
+// per-key errors are only logged, as provider errors may reveal internal details.
+func (h *Handler) addDeleteResults(res *BatchDeleteResponse, results []blobstore.DeleteResult) {
+	for _, result := range results {
+		entry := BatchDeleteResult{Key: result.Key, Deleted: result.Err == nil}
+		if result.Err != nil {
+			h.logger.Warn("Failed to delete blob", slog.String("key", result.Key), slog.String("error", result.Err.Error()))
+			entry.Error = deleteErrorMessage(result.Err)
+			res.Failed++
+		} else {
+			res.Deleted++
+		}
+
+		res.Results = append(res.Results, entry)
+	}
+}
+
+// deleteErrorMessage maps a delete error to a message safe to report per key.
+func deleteErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, blobstore.ErrBlobNotFound):
+		return "blob not found"
+	case errors.Is(err, blobstore.ErrInvalidKey):
+		return err.Error()
+	case errors.Is(err, secret.ErrForbidden):
+		return "forbidden"
+	default:
+		return "failed to delete blob"
+	}
+}
+
+func (h *Handler) HandleBatchDelete(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.batchDelete(w, r)
+	default:
+		response.RenderErrorJSON(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) batchDelete(w http.ResponseWriter, r *http.Request) {
+	var req BatchDeleteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBodySize)).Decode(&req); err != nil {
+		response.RenderErrorJSON(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Keys) == 0 || len(req.Keys) > blobstore.MaxDeleteBatch {
+		response.RenderErrorJSON(w, fmt.Sprintf("keys must contain between 1 and %d keys", blobstore.MaxDeleteBatch), http.StatusBadRequest)
+		return
+	}
+
+	keys := make([]string, len(req.Keys))
+	for i, key := range req.Keys {
+		keys[i] = blobstore.NormalizeKey(key)
+	}
+
+	h.logger.Debug("Deleting blobs", slog.Int("keys", len(keys)))
+	results, err := h.store.DeleteMany(r.Context(), keys)
+	if err != nil {
+		h.logger.Error("Failed to delete blobs", slog.String("error", err.Error()))
+		response.RenderErrorJSON(w, "Failed to delete blobs", http.StatusInternalServerError)
+		return
+	}
+
+	var res BatchDeleteResponse
+	h.addDeleteResults(&res, results)
+	response.RenderJSON(w, res)
+}
+
+// deleteByPrefix deletes every blob under a prefix, one page at a time.
+func (h *Handler) deleteByPrefix(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimSpace(r.URL.Query().Get("prefix"))
+	if prefix == "" {
+		response.RenderErrorJSON(w, "prefix is required", http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info("Deleting blobs by prefix", slog.String("prefix", prefix))
+	res := BatchDeleteResponse{Results: []BatchDeleteResult{}}
+	opts := blobstore.ListOptions{Prefix: prefix, Limit: blobstore.MaxDeleteBatch}
+	for {
+		page, err := h.store.ListPage(r.Context(), opts)
+		if err != nil {
+			if errors.Is(err, secret.ErrForbidden) {
+				response.RenderErrorJSON(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			h.logger.Error("failed to list blobs", slog.String("prefix", prefix), slog.String("error", err.Error()))
+			renderPartialDelete(w, res, "Failed to list blobs")
+			return
+		}
+
+		if len(page.Items) > 0 {
+			results, err := h.store.DeleteMany(r.Context(), page.Keys())
+			if err != nil {
+				h.logger.Error("Failed to delete blobs", slog.String("prefix", prefix), slog.String("error", err.Error()))
+				renderPartialDelete(w, res, "Failed to delete blobs")
+				return
+			}
+			h.addDeleteResults(&res, results)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	response.RenderJSON(w, res)
+}
+
+// renderPartialDelete reports a prefix delete that stopped with an error. Once
+// some keys were processed, the results so far are returned, so clients know
+// what was already deleted.
+func renderPartialDelete(w http.ResponseWriter, res BatchDeleteResponse, message string) {
+	if res.Deleted == 0 && res.Failed == 0 {
+		response.RenderErrorJSON(w, message, http.StatusInternalServerError)
+		return
+	}
+
+	res.Error = message
+	response.RenderJSONStatus(w, res, http.StatusInternalServerError)
+}
@@ -0,0 +1,76 @@
+package blob
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/timgluz/blobber/pkg/blobstore"
+)
+
+// notModified evaluates If-None-Match and If-Modified-Since for a GET or HEAD,
+// see RFC 9110, section 13.2.2. If-Modified-Since is ignored when the request
+// carries If-None-Match.
+func notModified(r *http.Request, info blobstore.BlobInfo) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagListMatches(ifNoneMatch, info.ETag)
+	}
+
+	ifModifiedSince := r.Header.Get("If-Modified-Since")
+	if ifModifiedSince == "" || info.LastModified.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+
+	return !info.LastModified.Truncate(time.Second).After(since)
+}
+
+// etagListMatches reports whether the comma separated list of entity tags
+// contains "*" or the given unquoted ETag, using weak comparison.
+func etagListMatches(list, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if etag != "" && strings.Trim(candidate, `"`) == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writePreconditions parses If-Match and If-None-Match of a PUT or DELETE. Only
+// a single strong entity tag in If-Match and "*" in If-None-Match are supported.
+func writePreconditions(r *http.Request) (ifMatch string, ifNoneMatch bool, err error) {
+	if value := strings.TrimSpace(r.Header.Get("If-Match")); value != "" {
+		if value == "*" || strings.Contains(value, ",") || strings.HasPrefix(value, "W/") {
+			return "", false, errors.New("If-Match must be a single strong entity tag")
+		}
+		ifMatch = strings.Trim(value, `"`)
+	}
+
+	if value := strings.TrimSpace(r.Header.Get("If-None-Match")); value != "" {
+		if value != "*" {
+			return "", false, errors.New("If-None-Match only supports *")
+		}
+		ifNoneMatch = true
+	}
+
+	return ifMatch, ifNoneMatch, nil
+}
+
+// writeNotModified answers a conditional GET or HEAD with 304 and the validators.
+func writeNotModified(w http.ResponseWriter, info blobstore.BlobInfo) {
+	writeBlobInfoHeaders(w, info)
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,291 @@
+package blob
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/timgluz/blobber/pkg/blobstore"
+	"github.com/timgluz/blobber/pkg/response"
+)
+
+// Limits protecting archive extraction against decompression bombs.
+const (
+	maxExtractEntries = 10000
+	maxExtractSize    = 1 << 30 // total uncompressed bytes
+	// maxCompressionRatio is only enforced for zip entries larger than 1MB.
+	maxCompressionRatio = 100
+)
+
+var (
+	errExtractLimit = errors.New("archive exceeds the extraction limits")
+	// errExtractStaging marks failures of the server to spool the upload.
+	errExtractStaging = errors.New("failed to stage the archive")
+)
+
+// ExtractResult reports the outcome of extracting a single archive entry.
+type ExtractResult struct {
+	Name  string `json:"name"`
+	Key   string `json:"key,omitempty"`
+	Size  int64  `json:"size"`
+	Error string `json:"error,omitempty"`
+}
+
+// ExtractResponse is the per-entry report of an archive upload.
+type ExtractResponse struct {
+	Extracted int             `json:"extracted"`
+	Failed    int             `json:"failed"`
+	Entries   []ExtractResult `json:"entries"`
+	// Error is why the extraction was aborted; the entries stored before stay listed.
+	Error string `json:"error,omitempty"`
+}
+
+// extractor writes archive entries below a prefix while enforcing the limits.
+type extractor struct {
+	h       *Handler
+	r       *http.Request
+	prefix  string
+	entries int
+	budget  int64 // uncompressed bytes left
+	report  ExtractResponse
+}
+
+// extractArchive handles PUT /blobs/{prefix}/?extract=zip|tar|tar.gz and stores
+// every regular file of the archive as its own blob below the prefix.
+func (h *Handler) extractArchive(w http.ResponseWriter, r *http.Request, format string) {
+	defer r.Body.Close()
+
+	prefix := blobstore.NormalizeKey(r.PathValue("key"))
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	x := &extractor{h: h, r: r, prefix: prefix, budget: maxExtractSize, report: ExtractResponse{Entries: []ExtractResult{}}}
+
+	h.logger.Info("Extracting archive", slog.String("prefix", prefix), slog.String("format", format))
+	var err error
+	switch format {
+	case "zip":
+		err = x.extractZip(r.Body)
+	case "tar":
+		err = x.extractTar(r.Body)
+	case "tar.gz":
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(r.Body); err == nil {
+			err = x.extractTar(gz)
+		}
+	default:
+		response.RenderErrorJSON(w, "extract must be zip, tar or tar.gz", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		status, message := http.StatusBadRequest, "Invalid archive: "+err.Error()
+		switch {
+		case errors.Is(err, errExtractLimit):
+			status, message = http.StatusRequestEntityTooLarge, err.Error()
+			h.logger.Warn("Archive extraction aborted", slog.String("prefix", prefix),
+				slog.Int("extracted", x.report.Extracted), slog.String("error", err.Error()))
+		case errors.Is(err, errExtractStaging):
+			status, message = http.StatusInternalServerError, "Failed to extract archive"
+			h.logger.Error("Failed to extract archive", slog.String("prefix", prefix), slog.String("error", err.Error()))
+		default:
+			h.logger.Warn("Invalid archive", slog.String("prefix", prefix),
+				slog.Int("extracted", x.report.Extracted), slog.String("error", err.Error()))
+		}
+
+		// entries stored before the failure are kept and listed, so the client
+		// can clean them up or resume with a smaller archive
+		if x.report.Extracted > 0 || errors.Is(err, errExtractLimit) {
+			x.report.Error = message
+			response.RenderJSONStatus(w, x.report, status)
+			return
+		}
+
+		response.RenderErrorJSON(w, message, status)
+		return
+	}
+
+	response.RenderJSON(w, x.report)
+}
+
+// extractZip spools the upload to a temp file, as zip archives are read from the end.
+func (x *extractor) extractZip(body io.Reader) error {
+	file, err := os.CreateTemp("", "blobber-extract-*.zip")
+	if err != nil {
+		return fmt.Errorf("%w: %w", errExtractStaging, err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	size, err := io.Copy(file, io.LimitReader(body, maxExtractSize+1))
+	if err != nil {
+		// file errors are the server's, anything else comes from reading the upload
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			return fmt.Errorf("%w: %w", errExtractStaging, err)
+		}
+		return err
+	}
+	if size > maxExtractSize {
+		return errExtractLimit
+	}
+
+	zr, err := zip.NewReader(file, size)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range zr.File {
+		mode := entry.Mode()
+		if mode.IsDir() {
+			continue
+		}
+
+		if err := x.check(int64(entry.UncompressedSize64)); err != nil {
+			return err
+		}
+
+		if entry.UncompressedSize64 > 1<<20 && entry.UncompressedSize64 > entry.CompressedSize64*maxCompressionRatio {
+			return fmt.Errorf("%w: entry %s has a suspicious compression ratio", errExtractLimit, entry.Name)
+		}
+
+		if !mode.IsRegular() {
+			x.fail(entry.Name, "", errors.New("unsupported entry type"))
+			continue
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			x.fail(entry.Name, "", err)
+			continue
+		}
+
+		err = x.store(entry.Name, rc, int64(entry.UncompressedSize64))
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (x *extractor) extractTar(body io.Reader) error {
+	tr := tar.NewReader(body)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeDir || header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		if err := x.check(header.Size); err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			x.fail(header.Name, "", errors.New("unsupported entry type"))
+			continue
+		}
+
+		if err := x.store(header.Name, tr, header.Size); err != nil {
+			return err
+		}
+	}
+}
+
+// check enforces the entry count and the size budget before an entry is read.
+func (x *extractor) check(size int64) error {
+	x.entries++
+	if x.entries > maxExtractEntries {
+		return fmt.Errorf("%w: more than %d entries", errExtractLimit, maxExtractEntries)
+	}
+
+	if size > x.budget {
+		return fmt.Errorf("%w: more than %d bytes uncompressed", errExtractLimit, maxExtractSize)
+	}
+
+	return nil
+}
+
+// store writes a single entry. Unsafe names and store errors are reported per
+// entry; only exceeding the limits aborts the extraction.
+func (x *extractor) store(name string, r io.Reader, size int64) error {
+	key, err := x.entryKey(name)
+	if err != nil {
+		x.fail(name, "", err)
+		return nil
+	}
+
+	// the declared size may lie, so the budget is enforced on the bytes read
+	counted := &budgetReader{r: r, budget: &x.budget}
+	opts := blobstore.PutOptions{ContentType: mime.TypeByExtension(path.Ext(key))}
+	err = x.h.store.PutReader(x.r.Context(), key, counted, size, opts)
+	if x.budget < 0 {
+		return fmt.Errorf("%w: more than %d bytes uncompressed", errExtractLimit, maxExtractSize)
+	}
+	if err != nil {
+		x.h.logger.Error("Failed to store archive entry", slog.String("key", key), slog.String("error", err.Error()))
+		x.fail(name, key, errors.New(storeErrorMessage(err)))
+		return nil
+	}
+
+	x.report.Extracted++
+	x.report.Entries = append(x.report.Entries, ExtractResult{Name: name, Key: key, Size: counted.read})
+	return nil
+}
+
+// entryKey maps an entry name to a key below the prefix, rejecting names that
+// would escape it (zip-slip).
+func (x *extractor) entryKey(name string) (string, error) {
+	if strings.Contains(name, `\`) || path.IsAbs(name) || !fs.ValidPath(strings.TrimPrefix(name, "./")) {
+		return "", errors.New("unsafe entry path")
+	}
+
+	key := blobstore.NormalizeKey(x.prefix + strings.TrimPrefix(name, "./"))
+	if err := blobstore.ValidateKey(key); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+func (x *extractor) fail(name, key string, err error) {
+	x.report.Failed++
+	x.report.Entries = append(x.report.Entries, ExtractResult{Name: name, Key: key, Error: err.Error()})
+}
+
+// budgetReader deducts the bytes read from a shared budget and fails once it is exhausted.
+type budgetReader struct {
+	r      io.Reader
+	budget *int64
+	read   int64
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += int64(n)
+	*b.budget -= int64(n)
+	if *b.budget < 0 {
+		return n, errExtractLimit
+	}
+
+	return n, err
+}
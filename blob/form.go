@@ -0,0 +1,175 @@
+package blob
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/timgluz/blobber/pkg/blobstore"
+	"github.com/timgluz/blobber/pkg/response"
+	"github.com/timgluz/blobber/pkg/secret"
+)
+
+// formKeyField names the form field that sets the key of the following file part.
+const formKeyField = "key"
+
+// maxFormFieldSize limits the text fields of upload forms.
+const maxFormFieldSize = 4 << 10
+
+// UploadResult reports the outcome of storing a single file part.
+type UploadResult struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename,omitempty"`
+	Key         string `json:"key,omitempty"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// UploadResponse summarizes a multipart/form-data upload.
+type UploadResponse struct {
+	Uploaded int            `json:"uploaded"`
+	Failed   int            `json:"failed"`
+	Files    []UploadResult `json:"files"`
+}
+
+// isFormUpload reports whether the request body is a multipart/form-data form.
+func isFormUpload(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// uploadForm stores every file part of a multipart/form-data request below the
+// prefix, under its filename or under the value of a preceding "key" field. The
+// parts are streamed to the store one after another.
+func (h *Handler) uploadForm(w http.ResponseWriter, r *http.Request, prefix string) {
+	defer r.Body.Close()
+
+	prefix = blobstore.NormalizeKey(prefix)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		response.RenderErrorJSON(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+
+	res := UploadResponse{Files: []UploadResult{}}
+	explicitKey := ""
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			response.RenderErrorJSON(w, "Invalid multipart form", http.StatusBadRequest)
+			return
+		}
+
+		if part.FileName() == "" {
+			if part.FormName() == formKeyField {
+				value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize))
+				if err != nil {
+					response.RenderErrorJSON(w, "Invalid multipart form", http.StatusBadRequest)
+					return
+				}
+				explicitKey = strings.TrimSpace(string(value))
+			}
+			part.Close()
+			continue
+		}
+
+		name := part.FileName()
+		if explicitKey != "" {
+			name, explicitKey = explicitKey, ""
+		}
+
+		result := h.storeFormPart(r, part, prefix+name)
+		part.Close()
+
+		if result.Error != "" {
+			res.Failed++
+		} else {
+			res.Uploaded++
+		}
+		res.Files = append(res.Files, result)
+	}
+
+	if len(res.Files) == 0 {
+		response.RenderErrorJSON(w, "The form contains no files", http.StatusBadRequest)
+		return
+	}
+
+	response.RenderJSON(w, res)
+}
+
+func (h *Handler) storeFormPart(r *http.Request, part *multipart.Part, rawKey string) UploadResult {
+	result := UploadResult{Field: part.FormName(), Filename: part.FileName()}
+
+	key, err := parseKey(rawKey)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Key = key
+
+	// browsers send application/octet-stream for files they don't recognize
+	declared := part.Header.Get("Content-Type")
+	if declared == "" || declared == response.ContentTypeOctetStream {
+		declared = mime.TypeByExtension(path.Ext(key))
+	}
+
+	contentType, body, err := detectContentType(declared, part)
+	if err != nil {
+		result.Error = "invalid Content-Type"
+		return result
+	}
+	result.ContentType = contentType
+
+	counted := &countingReader{r: body}
+	h.logger.Debug("Storing form file", slog.String("key", key), slog.String("content_type", contentType))
+	if err := h.store.PutReader(r.Context(), key, counted, -1, blobstore.PutOptions{ContentType: contentType}); err != nil {
+		h.logger.Error("Failed to store form file", slog.String("key", key), slog.String("error", err.Error()))
+		result.Error = storeErrorMessage(err)
+		return result
+	}
+
+	result.Size = counted.n
+	return result
+}
+
+// storeErrorMessage maps a store error to a message safe to report per file;
+// provider errors are only logged, as they may reveal internal details.
+func storeErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, blobstore.ErrPreconditionFailed):
+		return "blob precondition failed"
+	case errors.Is(err, blobstore.ErrBlobTooLarge):
+		return "blob is too large"
+	case errors.Is(err, blobstore.ErrInvalidKey):
+		return err.Error()
+	case errors.Is(err, secret.ErrForbidden):
+		return "forbidden"
+	default:
+		return "failed to store file"
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -2,30 +2,45 @@ package blob
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/timgluz/blobber/pkg/blobstore"
 	"github.com/timgluz/blobber/pkg/response"
+	"github.com/timgluz/blobber/pkg/secret"
+	"github.com/timgluz/blobber/pkg/sharelink"
 )
 
 type Handler struct {
-	store  blobstore.BlobStore
-	logger *slog.Logger
+	store     blobstore.BlobStore
+	presigner blobstore.Presigner
+	logger    *slog.Logger
+
+	shareConfig sharelink.Config
+	shareSigner *sharelink.Signer
 }
 
+// NewHandler wraps the store, so the scopes of the principal in the request
+// context are enforced on every blob operation.
 func NewHandler(store blobstore.BlobStore, logger *slog.Logger) *Handler {
-	return &Handler{store: store, logger: logger}
+	presigner, _ := store.(blobstore.Presigner)
+	return &Handler{store: secret.NewScopedStore(store), presigner: presigner, logger: logger}
 }
 
 func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		h.getBlob(w, r)
-	case http.MethodPut, http.MethodPost:
+	case http.MethodHead:
+		h.headBlob(w, r)
+	case http.MethodPut:
 		h.putBlob(w, r)
+	case http.MethodPost:
+		h.postBlob(w, r)
 	case http.MethodDelete:
 		h.deleteBlob(w, r)
 	default:
@@ -37,72 +52,273 @@ func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		h.listBlobs(w, r)
+	case http.MethodPost:
+		h.uploadForm(w, r, "")
+	case http.MethodDelete:
+		h.deleteByPrefix(w, r)
 	default:
 		response.RenderErrorJSON(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 func (h *Handler) listBlobs(w http.ResponseWriter, r *http.Request) {
-	prefix := r.URL.Query().Get("prefix")
-	prefix = strings.TrimSpace(prefix)
+	query := r.URL.Query()
+	opts := blobstore.ListOptions{
+		Prefix:    strings.TrimSpace(query.Get("prefix")),
+		Delimiter: query.Get("delimiter"),
+		Limit:     blobstore.DefaultListLimit,
+		Cursor:    query.Get("cursor"),
+	}
+
+	if format := query.Get("archive"); format != "" {
+		h.archiveBlobs(w, r, opts.Prefix, format)
+		return
+	}
+
+	details := false
+	if value := query.Get("details"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			response.RenderErrorJSON(w, "details must be true or false", http.StatusBadRequest)
+			return
+		}
+		details = parsed
+	}
+	opts.Details = details
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > blobstore.MaxListLimit {
+			response.RenderErrorJSON(w, fmt.Sprintf("limit must be between 1 and %d", blobstore.MaxListLimit), http.StatusBadRequest)
+			return
+		}
+		opts.Limit = limit
+	}
 
-	h.logger.Debug("Listing blobs", slog.String("prefix", prefix))
-	blobs, err := h.store.List(r.Context(), prefix)
+	h.logger.Debug("Listing blobs", slog.String("prefix", opts.Prefix),
+		slog.String("delimiter", opts.Delimiter), slog.Int("limit", opts.Limit))
+	page, err := h.store.ListPage(r.Context(), opts)
 	if err != nil {
+		if errors.Is(err, blobstore.ErrInvalidCursor) {
+			response.RenderErrorJSON(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, secret.ErrForbidden) {
+			response.RenderErrorJSON(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
 		h.logger.Error("failed to list blobs", slog.String("error", err.Error()))
 		response.RenderErrorJSON(w, "Failed to list blobs", http.StatusInternalServerError)
 		return
 	}
 
-	response.RenderPaginatedJSON(w, blobs, response.Pagination{
-		Page:       1,
-		PageSize:   len(blobs),
-		TotalItems: len(blobs),
-		TotalPages: 1,
+	pagination := response.Pagination{PageSize: opts.Limit}
+	if details {
+		response.RenderPaginatedJSON(w, response.PaginatedResponse[blobstore.BlobInfo]{
+			Items:      page.Items,
+			Prefixes:   page.Prefixes,
+			Pagination: pagination,
+			NextCursor: page.NextCursor,
+		})
+		return
+	}
+
+	response.RenderPaginatedJSON(w, response.PaginatedResponse[string]{
+		Items:      page.Keys(),
+		Prefixes:   page.Prefixes,
+		Pagination: pagination,
+		NextCursor: page.NextCursor,
 	})
 }
 
 func (h *Handler) getBlob(w http.ResponseWriter, r *http.Request) {
-	key := r.PathValue("key")
-	if key == "" {
-		http.Error(w, "Key is required", http.StatusBadRequest)
+	key, err := blobKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	h.logger.Debug("Fetching blob", slog.String("key", key))
-	data, err := h.store.Get(r.Context(), key)
+	info, err := h.store.Stat(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrBlobNotFound) {
+			http.Error(w, "Blob not found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, blobstore.ErrInvalidKey) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, secret.ErrForbidden) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		h.logger.Error("Failed to fetch blob info", slog.String("key", key), slog.String("error", err.Error()))
+		http.Error(w, "Failed to fetch blob", http.StatusInternalServerError)
+		return
+	}
+
+	if notModified(r, info) {
+		h.logger.Debug("Blob not modified", slog.String("key", key))
+		writeNotModified(w, info)
+		return
+	}
+
+	if !acceptsContentType(r.Header.Get("Accept"), blobContentType(info)) {
+		http.Error(w, "Blob content type "+blobContentType(info)+" is not acceptable", http.StatusNotAcceptable)
+		return
+	}
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	blobRange, partial, err := requestedRange(r, info)
 	if err != nil {
-		http.Error(w, "Blob not found", http.StatusNotFound)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		http.Error(w, "Range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
 		return
 	}
 
-	requestedMimeType := r.Header.Get("Accept")
-	if requestedMimeType != "" {
-		w.Header().Set("Content-Type", requestedMimeType)
+	var reader io.ReadCloser
+	if partial {
+		h.logger.Debug("Fetching blob range", slog.String("key", key),
+			slog.Int64("offset", blobRange.start), slog.Int64("length", blobRange.length))
+		reader, err = h.store.GetRange(r.Context(), key, blobRange.start, blobRange.length)
 	} else {
-		w.Header().Set("Content-Type", response.ContentTypeOctetStream)
+		reader, err = h.store.GetReader(r.Context(), key)
+	}
+	if err != nil {
+		if errors.Is(err, blobstore.ErrBlobNotFound) {
+			http.Error(w, "Blob not found", http.StatusNotFound)
+			return
+		}
+
+		h.logger.Error("Failed to fetch blob", slog.String("key", key), slog.String("error", err.Error()))
+		http.Error(w, "Failed to fetch blob", http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	writeBlobInfoHeaders(w, info)
+	w.Header().Add("Vary", "Accept")
+	if partial {
+		w.Header().Set("Content-Range", blobRange.contentRange(info.Size))
+		w.Header().Set("Content-Length", strconv.FormatInt(blobRange.length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		w.WriteHeader(http.StatusOK)
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		h.logger.Error("Failed to stream blob", slog.String("key", key), slog.String("error", err.Error()))
+	}
+}
+
+func (h *Handler) headBlob(w http.ResponseWriter, r *http.Request) {
+	key, err := blobKey(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Debug("Fetching blob info", slog.String("key", key))
+	info, err := h.store.Stat(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrBlobNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, blobstore.ErrInvalidKey) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, secret.ErrForbidden) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		h.logger.Error("Failed to fetch blob info", slog.String("key", key), slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if notModified(r, info) {
+		writeNotModified(w, info)
+		return
 	}
 
+	writeBlobInfoHeaders(w, info)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
 	w.WriteHeader(http.StatusOK)
-	w.Write(data)
 }
 
 func (h *Handler) putBlob(w http.ResponseWriter, r *http.Request) {
-	key := r.PathValue("key")
-	if key == "" {
-		response.RenderErrorJSON(w, "Key is required", http.StatusBadRequest)
+	if format := r.URL.Query().Get("extract"); format != "" {
+		h.extractArchive(w, r, format)
 		return
 	}
 
-	data, err := io.ReadAll(r.Body)
+	key, err := blobKey(r)
 	if err != nil {
-		response.RenderErrorJSON(w, "Failed to read request body", http.StatusBadRequest)
+		response.RenderErrorJSON(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+
 	defer r.Body.Close()
 
-	err = h.store.Put(r.Context(), key, data)
+	ifMatch, ifNoneMatch, err := writePreconditions(r)
+	if err != nil {
+		response.RenderErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType, body, err := uploadContentType(r)
 	if err != nil {
+		response.RenderErrorJSON(w, "Invalid Content-Type", http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Debug("Storing blob", slog.String("key", key),
+		slog.Int64("size", r.ContentLength), slog.String("content_type", contentType))
+	opts := blobstore.PutOptions{
+		ContentType: contentType,
+		IfMatch:     ifMatch,
+		IfNoneMatch: ifNoneMatch,
+	}
+	err = h.store.PutReader(r.Context(), key, body, r.ContentLength, opts)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrPreconditionFailed) {
+			response.RenderErrorJSON(w, "Blob precondition failed", http.StatusPreconditionFailed)
+			return
+		}
+
+		if errors.Is(err, blobstore.ErrPreconditionNotSupported) {
+			response.RenderErrorJSON(w, "If-Match is not supported by the storage backend", http.StatusNotImplemented)
+			return
+		}
+
+		if errors.Is(err, blobstore.ErrBlobTooLarge) {
+			response.RenderErrorJSON(w, "Blob is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if errors.Is(err, blobstore.ErrInvalidKey) {
+			response.RenderErrorJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, secret.ErrForbidden) {
+			response.RenderErrorJSON(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		h.logger.Error("Failed to store blob", slog.String("key", key), slog.String("error", err.Error()))
 		response.RenderErrorJSON(w, "Failed to store blob", http.StatusInternalServerError)
 		return
 	}
@@ -111,19 +327,45 @@ func (h *Handler) putBlob(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) deleteBlob(w http.ResponseWriter, r *http.Request) {
-	key := r.PathValue("key")
-	if key == "" {
-		http.Error(w, "Key is required", http.StatusBadRequest)
+	key, err := blobKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ifMatch, _, err := writePreconditions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	h.logger.Debug("Deleting blob", slog.String("key", key))
-	if err := h.store.Delete(r.Context(), key); err != nil {
+	if err := h.store.DeleteWithOptions(r.Context(), key, blobstore.DeleteOptions{IfMatch: ifMatch}); err != nil {
+		if errors.Is(err, blobstore.ErrPreconditionFailed) {
+			http.Error(w, "Blob precondition failed", http.StatusPreconditionFailed)
+			return
+		}
+
+		if errors.Is(err, blobstore.ErrPreconditionNotSupported) {
+			http.Error(w, "If-Match is not supported by the storage backend", http.StatusNotImplemented)
+			return
+		}
+
 		if errors.Is(err, blobstore.ErrBlobNotFound) {
 			http.Error(w, "Blob not found", http.StatusNotFound)
 			return
 		}
 
+		if errors.Is(err, blobstore.ErrInvalidKey) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, secret.ErrForbidden) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
 		h.logger.Error("Failed to delete blob", slog.String("error", err.Error()))
 		http.Error(w, "Failed to delete blob", http.StatusInternalServerError)
 		return
@@ -132,3 +374,48 @@ func (h *Handler) deleteBlob(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("Blob deleted", slog.String("key", key))
 	response.RenderSuccessJSON(w, "Blob deleted successfully", http.StatusNoContent)
 }
+
+// blobKey extracts the key from the request path, which may span several
+// segments like "users/42/avatar.png", and normalizes and validates it.
+func blobKey(r *http.Request) (string, error) {
+	return parseKey(r.PathValue("key"))
+}
+
+// parseKey normalizes and validates a key given by the client.
+func parseKey(raw string) (string, error) {
+	key := blobstore.NormalizeKey(raw)
+	if err := blobstore.ValidateKey(key); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// MetadataHeaderPrefix is prepended to user metadata keys when they are returned as headers.
+const MetadataHeaderPrefix = "X-Blobber-Meta-"
+
+// blobContentType returns the stored content type, falling back to a generic binary type.
+func blobContentType(info blobstore.BlobInfo) string {
+	if info.ContentType == "" {
+		return response.ContentTypeOctetStream
+	}
+
+	return info.ContentType
+}
+
+func writeBlobInfoHeaders(w http.ResponseWriter, info blobstore.BlobInfo) {
+	header := w.Header()
+	header.Set("Content-Type", blobContentType(info))
+
+	if info.ETag != "" {
+		header.Set("ETag", strconv.Quote(info.ETag))
+	}
+
+	if !info.LastModified.IsZero() {
+		header.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	for name, value := range info.Metadata {
+		header.Set(MetadataHeaderPrefix+name, value)
+	}
+}
@@ -0,0 +1,1060 @@
+package blob_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timgluz/blobber/blob"
+	"github.com/timgluz/blobber/pkg/blobstore"
+	"github.com/timgluz/blobber/pkg/response"
+	"github.com/timgluz/blobber/pkg/secret"
+	"github.com/timgluz/blobber/pkg/sharelink"
+)
+
+func TestHandler_PutAndGetStreamsLargeBlob(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 256*1024) // 4MB
+	res := doRequest(t, server, http.MethodPut, "/blobs/large.bin", bytes.NewReader(payload), nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs/large.bin", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, payload, body)
+}
+
+func TestHandler_HeadReturnsBlobInfo(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/info.txt", strings.NewReader("hello world"), nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodHead, "/blobs/info.txt", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "11", res.Header.Get("Content-Length"))
+	assert.NotEmpty(t, res.Header.Get("ETag"))
+	assert.NotEmpty(t, res.Header.Get("Last-Modified"))
+
+	res = doRequest(t, server, http.MethodHead, "/blobs/missing.txt", nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestHandler_GetServesStoredContentType(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/config.json", strings.NewReader(`{"a": 1}`),
+		http.Header{"Content-Type": {"application/json"}})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	browserAccept := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	res = doRequest(t, server, http.MethodGet, "/blobs/config.json", nil, http.Header{"Accept": {browserAccept}})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+	res = doRequest(t, server, http.MethodGet, "/blobs/config.json", nil, http.Header{"Accept": {"text/plain"}})
+	assert.Equal(t, http.StatusNotAcceptable, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs/config.json", nil, http.Header{"Accept": {"application/*, application/json;q=0"}})
+	assert.Equal(t, http.StatusNotAcceptable, res.StatusCode)
+}
+
+func TestHandler_PutSniffsMissingContentType(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/page", strings.NewReader("<html><body>hi</body></html>"), nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodHead, "/blobs/page", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+}
+
+func TestHandler_HierarchicalKeys(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/users/42/avatar.png", strings.NewReader("png"), nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs/users/42/avatar.png", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "png", string(body))
+
+	res = doRequest(t, server, http.MethodGet, "/blobs?prefix=users/42/", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"users/42/avatar.png"`)
+
+	res = doRequest(t, server, http.MethodDelete, "/blobs/users/42/avatar.png", nil, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+}
+
+func TestHandler_RejectsInvalidKeys(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	for _, path := range []string{"/blobs/users/%2e%2e/admin", "/blobs/tab%09key", "/blobs/dir/"} {
+		res := doRequest(t, server, http.MethodPut, path, strings.NewReader("nope"), nil)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "path %s", path)
+	}
+}
+
+func TestHandler_ListPaginatesWithCursor(t *testing.T) {
+	server, store := newTestServer(t)
+	for _, key := range []string{"k1", "k2", "k3"} {
+		require.NoError(t, store.Put(context.Background(), key, []byte(key)))
+	}
+
+	var page response.PaginatedResponse[string]
+	res := doRequest(t, server, http.MethodGet, "/blobs?limit=2", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&page))
+	assert.Equal(t, []string{"k1", "k2"}, page.Items)
+	require.NotEmpty(t, page.NextCursor)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs?limit=2&cursor="+url.QueryEscape(page.NextCursor), nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	page = response.PaginatedResponse[string]{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&page))
+	assert.Equal(t, []string{"k3"}, page.Items)
+	assert.Empty(t, page.NextCursor)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs?limit=0", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestHandler_ListWithDetails(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/docs/readme.md", strings.NewReader("# readme"),
+		http.Header{"Content-Type": {"text/markdown"}})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var page response.PaginatedResponse[blobstore.BlobInfo]
+	res = doRequest(t, server, http.MethodGet, "/blobs?prefix=docs/&details=true", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&page))
+
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "docs/readme.md", page.Items[0].Key)
+	assert.Equal(t, int64(8), page.Items[0].Size)
+	assert.Equal(t, "text/markdown", page.Items[0].ContentType)
+	assert.NotEmpty(t, page.Items[0].ETag)
+	assert.False(t, page.Items[0].LastModified.IsZero())
+
+	res = doRequest(t, server, http.MethodGet, "/blobs?details=maybe", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestHandler_GetServesByteRanges(t *testing.T) {
+	server, store := newTestServer(t)
+	require.NoError(t, store.Put(context.Background(), "digits.txt", []byte("0123456789")))
+
+	tests := []struct {
+		rangeHeader  string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"bytes=2-5", http.StatusPartialContent, "2345", "bytes 2-5/10"},
+		{"bytes=7-", http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"bytes=-3", http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"bytes=8-100", http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"bytes=0-1,4-5", http.StatusOK, "0123456789", ""},
+		{"bytes=10-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"items=0-1", http.StatusOK, "0123456789", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rangeHeader, func(t *testing.T) {
+			res := doRequest(t, server, http.MethodGet, "/blobs/digits.txt", nil, http.Header{"Range": {tt.rangeHeader}})
+			require.Equal(t, tt.status, res.StatusCode)
+			assert.Equal(t, tt.contentRange, res.Header.Get("Content-Range"))
+			assert.Equal(t, "bytes", res.Header.Get("Accept-Ranges"))
+
+			if tt.body != "" {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.body, string(body))
+			}
+		})
+	}
+}
+
+func TestHandler_GetIgnoresRangeWhenIfRangeIsStale(t *testing.T) {
+	server, store := newTestServer(t)
+	require.NoError(t, store.Put(context.Background(), "digits.txt", []byte("0123456789")))
+
+	res := doRequest(t, server, http.MethodHead, "/blobs/digits.txt", nil, nil)
+	etag := res.Header.Get("ETag")
+
+	res = doRequest(t, server, http.MethodGet, "/blobs/digits.txt", nil,
+		http.Header{"Range": {"bytes=0-1"}, "If-Range": {etag}})
+	assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs/digits.txt", nil,
+		http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"stale"`}})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestHandler_GetAnswersConditionalRequestsWithoutReading(t *testing.T) {
+	memoryStore, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{}, newTestLogger())
+	require.NoError(t, err)
+	store := &countingStore{BlobStore: memoryStore}
+	server := newTestServerWithStore(t, store)
+
+	require.NoError(t, store.Put(context.Background(), "config.json", []byte(`{"poll": true}`)))
+
+	res := doRequest(t, server, http.MethodGet, "/blobs/config.json", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	etag := res.Header.Get("ETag")
+	lastModified := res.Header.Get("Last-Modified")
+	require.NotEmpty(t, etag)
+	require.NotEmpty(t, lastModified)
+	require.Equal(t, 1, store.reads)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs/config.json", nil, http.Header{"If-None-Match": {`"other", ` + etag}})
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+	assert.Equal(t, etag, res.Header.Get("ETag"))
+
+	res = doRequest(t, server, http.MethodGet, "/blobs/config.json", nil, http.Header{"If-Modified-Since": {lastModified}})
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+	assert.Equal(t, 1, store.reads, "304 responses must not read the blob content")
+
+	res = doRequest(t, server, http.MethodGet, "/blobs/config.json", nil, http.Header{"If-None-Match": {`"stale"`}})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs/config.json", nil,
+		http.Header{"If-Modified-Since": {time.Unix(0, 0).UTC().Format(http.TimeFormat)}})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 3, store.reads)
+}
+
+func TestHandler_ConditionalWrites(t *testing.T) {
+	server, _ := newTestServer(t)
+	createOnly := http.Header{"If-None-Match": {"*"}}
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/state.json", strings.NewReader(`{"v": 1}`), createOnly)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodPut, "/blobs/state.json", strings.NewReader(`{"v": 2}`), createOnly)
+	assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodHead, "/blobs/state.json", nil, nil)
+	etag := res.Header.Get("ETag")
+
+	res = doRequest(t, server, http.MethodPut, "/blobs/state.json", strings.NewReader(`{"v": 2}`), http.Header{"If-Match": {etag}})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	// the first writer's ETag is stale now
+	res = doRequest(t, server, http.MethodPut, "/blobs/state.json", strings.NewReader(`{"v": 3}`), http.Header{"If-Match": {etag}})
+	assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodDelete, "/blobs/state.json", nil, http.Header{"If-Match": {etag}})
+	assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodHead, "/blobs/state.json", nil, nil)
+	res = doRequest(t, server, http.MethodDelete, "/blobs/state.json", nil, http.Header{"If-Match": {res.Header.Get("ETag")}})
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodPut, "/blobs/state.json", strings.NewReader("{}"), http.Header{"If-None-Match": {`"abc"`}})
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestHandler_RejectsUnsupportedIfMatch(t *testing.T) {
+	store, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{}, newTestLogger())
+	require.NoError(t, err)
+	server := newTestServerWithStore(t, &unconditionalStore{store})
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, "state.json", []byte(`{"v": 1}`)))
+	info, err := store.Stat(ctx, "state.json")
+	require.NoError(t, err)
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/state.json", strings.NewReader(`{"v": 2}`), http.Header{"If-Match": {info.ETag}})
+	assert.Equal(t, http.StatusNotImplemented, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodDelete, "/blobs/state.json", nil, http.Header{"If-Match": {info.ETag}})
+	assert.Equal(t, http.StatusNotImplemented, res.StatusCode)
+	require.NoError(t, store.Has(ctx, "state.json"))
+
+	// moves fall back to an unconditional delete of the source
+	res = doRequest(t, server, http.MethodPost, "/blobs/state.json:move", strings.NewReader(`{"destination": "moved.json"}`), nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.ErrorIs(t, store.Has(ctx, "state.json"), blobstore.ErrBlobNotFound)
+	require.NoError(t, store.Has(ctx, "moved.json"))
+}
+
+func TestHandler_CopyAndMoveBlob(t *testing.T) {
+	server, store := newTestServer(t)
+	ctx := context.Background()
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/docs/draft.md", strings.NewReader("# draft"),
+		http.Header{"Content-Type": {"text/markdown"}})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodPost, "/blobs/docs/draft.md:copy", strings.NewReader(`{"destination": "docs/backup.md"}`), nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	info, err := store.Stat(ctx, "docs/backup.md")
+	require.NoError(t, err)
+	assert.Equal(t, "text/markdown", info.ContentType)
+	require.NoError(t, store.Has(ctx, "docs/draft.md"))
+
+	res = doRequest(t, server, http.MethodPost, "/blobs/docs/draft.md:move", strings.NewReader(`{"destination": "docs/final.md"}`), nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	data, err := store.Get(ctx, "docs/final.md")
+	require.NoError(t, err)
+	assert.Equal(t, "# draft", string(data))
+	assert.ErrorIs(t, store.Has(ctx, "docs/draft.md"), blobstore.ErrBlobNotFound)
+
+	res = doRequest(t, server, http.MethodPost, "/blobs/docs/draft.md:move", strings.NewReader(`{"destination": "docs/other.md"}`), nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodPost, "/blobs/docs/final.md:copy", strings.NewReader(`{"destination": "../escape"}`), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// POST to a plain key still stores the body
+	res = doRequest(t, server, http.MethodPost, "/blobs/docs/notes:txt", strings.NewReader("notes"), nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.NoError(t, store.Has(ctx, "docs/notes:txt"))
+}
+
+func TestHandler_BatchDelete(t *testing.T) {
+	server, store := newTestServer(t)
+	ctx := context.Background()
+	for _, key := range []string{"a.txt", "b.txt", "c.txt"} {
+		require.NoError(t, store.Put(ctx, key, []byte(key)))
+	}
+
+	body := `{"keys": ["a.txt", "b.txt", "missing.txt", "bad/../key"]}`
+	res := doRequest(t, server, http.MethodPost, "/blobs:batchDelete", strings.NewReader(body), nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var result blob.BatchDeleteResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+	assert.Equal(t, 3, result.Deleted)
+	assert.Equal(t, 1, result.Failed)
+	require.Len(t, result.Results, 4)
+	assert.Equal(t, blob.BatchDeleteResult{Key: "missing.txt", Deleted: true}, result.Results[2])
+	assert.False(t, result.Results[3].Deleted)
+	assert.NotEmpty(t, result.Results[3].Error)
+
+	keys, err := store.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c.txt"}, keys)
+
+	res = doRequest(t, server, http.MethodPost, "/blobs:batchDelete", strings.NewReader(`{"keys": []}`), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestHandler_BatchDeleteHidesStoreErrors(t *testing.T) {
+	store, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{}, newTestLogger())
+	require.NoError(t, err)
+	server := newTestServerWithStore(t, failingStore{BlobStore: store, err: errors.New("AccessDenied: request 4F2A in bucket internal-prod")})
+
+	res := doRequest(t, server, http.MethodPost, "/blobs:batchDelete", strings.NewReader(`{"keys": ["a.txt"]}`), nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var result blob.BatchDeleteResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+	assert.Equal(t, 1, result.Failed)
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, "failed to delete blob", result.Results[0].Error)
+}
+
+func TestHandler_DeleteByPrefix(t *testing.T) {
+	server, store := newTestServer(t)
+	ctx := context.Background()
+	for i := range 1500 {
+		require.NoError(t, store.Put(ctx, fmt.Sprintf("users/42/%04d", i), []byte("x")))
+	}
+	require.NoError(t, store.Put(ctx, "users/43/keep", []byte("x")))
+
+	res := doRequest(t, server, http.MethodDelete, "/blobs?prefix=users/42/", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var result blob.BatchDeleteResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+	assert.Equal(t, 1500, result.Deleted)
+	assert.Zero(t, result.Failed)
+
+	keys, err := store.List(ctx, "users/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users/43/keep"}, keys)
+
+	res = doRequest(t, server, http.MethodDelete, "/blobs", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestHandler_DeleteByPrefixReportsPartialResults(t *testing.T) {
+	store, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{}, newTestLogger())
+	require.NoError(t, err)
+	ctx := context.Background()
+	for i := range 1500 {
+		require.NoError(t, store.Put(ctx, fmt.Sprintf("users/42/%04d", i), []byte("x")))
+	}
+	server := newTestServerWithStore(t, &firstPageStore{BlobStore: store})
+
+	res := doRequest(t, server, http.MethodDelete, "/blobs?prefix=users/42/", nil, nil)
+	require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+
+	var result blob.BatchDeleteResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+	assert.Equal(t, blobstore.MaxDeleteBatch, result.Deleted)
+	assert.Len(t, result.Results, blobstore.MaxDeleteBatch)
+	assert.Equal(t, "Failed to list blobs", result.Error)
+}
+
+func TestHandler_ArchiveDownload(t *testing.T) {
+	server, store := newTestServer(t)
+	ctx := context.Background()
+
+	files := map[string]string{
+		"reports/2026/q1.csv":      "q1",
+		"reports/2026/q2/data.csv": "q2",
+	}
+	for key, content := range files {
+		require.NoError(t, store.Put(ctx, key, []byte(content)))
+	}
+	require.NoError(t, store.Put(ctx, "reports/2025/q1.csv", []byte("old")))
+
+	expected := map[string]string{"q1.csv": "q1", "q2/data.csv": "q2"}
+
+	res := doRequest(t, server, http.MethodGet, "/blobs?prefix=reports/2026/&archive=zip", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/zip", res.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=2026.zip`, res.Header.Get("Content-Disposition"))
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+
+	entries := map[string]string{}
+	for _, file := range zr.File {
+		rc, err := file.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		entries[file.Name] = string(data)
+	}
+	assert.Equal(t, expected, entries)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs?prefix=reports/2026/&archive=tar.gz", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	gz, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	entries = map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		entries[header.Name] = string(data)
+	}
+	assert.Equal(t, expected, entries)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs?prefix=reports/&archive=rar", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestHandler_ExtractZipUpload(t *testing.T) {
+	server, store := newTestServer(t)
+	ctx := context.Background()
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, content := range map[string]string{
+		"index.html":         "<h1>hi</h1>",
+		"assets/app.js":      "console.log(1)",
+		"../../etc/passwd":   "nope",
+		"assets/../../x.txt": "nope",
+	} {
+		entry, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = entry.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	_, err := zw.Create("assets/")
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/site/?extract=zip", &archive, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var report blob.ExtractResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	assert.Equal(t, 2, report.Extracted)
+	assert.Equal(t, 2, report.Failed)
+
+	keys, err := store.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"site/assets/app.js", "site/index.html"}, keys)
+
+	info, err := store.Stat(ctx, "site/index.html")
+	require.NoError(t, err)
+	assert.Equal(t, "text/html; charset=utf-8", info.ContentType)
+}
+
+func TestHandler_ExtractTarGzUpload(t *testing.T) {
+	server, store := newTestServer(t)
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "docs/readme.md", Mode: 0o644, Size: 5, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "docs/link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/bundle/?extract=tar.gz", &archive, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var report blob.ExtractResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	assert.Equal(t, 1, report.Extracted)
+	assert.Equal(t, 1, report.Failed)
+
+	data, err := store.Get(context.Background(), "bundle/docs/readme.md")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestHandler_ExtractRejectsDecompressionBomb(t *testing.T) {
+	server, store := newTestServer(t)
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	entry, err := zw.Create("readme.txt")
+	require.NoError(t, err)
+	_, err = entry.Write([]byte("hello"))
+	require.NoError(t, err)
+	entry, err = zw.Create("zeros.bin")
+	require.NoError(t, err)
+	_, err = entry.Write(make([]byte, 8<<20))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/bomb/?extract=zip", &archive, nil)
+	require.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+
+	// the entries stored before the limit was hit are reported
+	var report blob.ExtractResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	assert.NotEmpty(t, report.Error)
+	assert.Equal(t, 1, report.Extracted)
+	require.Len(t, report.Entries, 1)
+	assert.Equal(t, "bomb/readme.txt", report.Entries[0].Key)
+	require.NoError(t, store.Has(context.Background(), "bomb/readme.txt"))
+}
+
+func TestHandler_ExtractReportsEntriesOfTruncatedArchive(t *testing.T) {
+	server, store := newTestServer(t)
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0o644, Size: 5, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "b.txt", Mode: 0o644, Size: 4096, Typeflag: tar.TypeReg}))
+	_, err = tw.Write(make([]byte, 4096))
+	require.NoError(t, err)
+	truncated := archive.Bytes()[:archive.Len()-2048]
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/cut/?extract=tar", bytes.NewReader(truncated), nil)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var report blob.ExtractResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	assert.Contains(t, report.Error, "Invalid archive")
+	assert.Equal(t, 1, report.Extracted)
+	require.NotEmpty(t, report.Entries)
+	assert.Equal(t, "cut/a.txt", report.Entries[0].Key)
+	require.NoError(t, store.Has(context.Background(), "cut/a.txt"))
+}
+
+func TestHandler_MultipartFormUpload(t *testing.T) {
+	server, store := newTestServer(t)
+	ctx := context.Background()
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	require.NoError(t, mw.WriteField("description", "ignored"))
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="photo.png"`)
+	header.Set("Content-Type", "image/png")
+	part, err := mw.CreatePart(header)
+	require.NoError(t, err)
+	_, err = part.Write([]byte("png data"))
+	require.NoError(t, err)
+
+	require.NoError(t, mw.WriteField("key", "notes/today.txt"))
+	part, err = mw.CreateFormFile("file", "upload.txt")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("plain text"))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	res := doRequest(t, server, http.MethodPost, "/blobs/users/42", &form,
+		http.Header{"Content-Type": {mw.FormDataContentType()}})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var summary blob.UploadResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&summary))
+	assert.Equal(t, 2, summary.Uploaded)
+	assert.Zero(t, summary.Failed)
+	require.Len(t, summary.Files, 2)
+	assert.Equal(t, "users/42/photo.png", summary.Files[0].Key)
+	assert.Equal(t, int64(8), summary.Files[0].Size)
+	assert.Equal(t, "users/42/notes/today.txt", summary.Files[1].Key)
+
+	info, err := store.Stat(ctx, "users/42/photo.png")
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", info.ContentType)
+
+	info, err = store.Stat(ctx, "users/42/notes/today.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", info.ContentType)
+
+	form.Reset()
+	mw = multipart.NewWriter(&form)
+	require.NoError(t, mw.WriteField("key", "nothing"))
+	require.NoError(t, mw.Close())
+
+	res = doRequest(t, server, http.MethodPost, "/blobs", &form, http.Header{"Content-Type": {mw.FormDataContentType()}})
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestHandler_MultipartFormUploadHidesStoreErrors(t *testing.T) {
+	server := newTestServerWithStore(t, failingStore{err: errors.New("dial tcp 10.0.0.5:9000: connection refused")})
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	part, err := mw.CreateFormFile("file", "upload.txt")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("plain text"))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	res := doRequest(t, server, http.MethodPost, "/blobs/users/42", &form,
+		http.Header{"Content-Type": {mw.FormDataContentType()}})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var summary blob.UploadResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&summary))
+	assert.Equal(t, 1, summary.Failed)
+	require.Len(t, summary.Files, 1)
+	assert.Equal(t, "failed to store file", summary.Files[0].Error)
+}
+
+func TestHandler_EnforcesTokenScopes(t *testing.T) {
+	store, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{}, newTestLogger())
+	require.NoError(t, err)
+	ctx := context.Background()
+	for _, key := range []string{"users/42/a.txt", "users/42/docs/b.txt", "users/7/c.txt", "uploads/d.txt"} {
+		require.NoError(t, store.Put(ctx, key, []byte(key)))
+	}
+
+	principal, err := secret.NewPrincipal("user-42", []string{"read:users/42/*", "list:users/42/*", "write:uploads/*"})
+	require.NoError(t, err)
+	server := newTestServerAs(t, store, principal)
+
+	res := doRequest(t, server, http.MethodGet, "/blobs/users/42/a.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs/users/7/c.txt", nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodPut, "/blobs/uploads/e.txt", strings.NewReader("e"), nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodPut, "/blobs/users/42/e.txt", strings.NewReader("e"), nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodDelete, "/blobs/users/42/a.txt", nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	var page response.PaginatedResponse[string]
+	res = doRequest(t, server, http.MethodGet, "/blobs", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&page))
+	assert.Equal(t, []string{"users/42/a.txt", "users/42/docs/b.txt"}, page.Items)
+
+	page = response.PaginatedResponse[string]{}
+	res = doRequest(t, server, http.MethodGet, "/blobs?prefix=users/7/", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&page))
+	assert.Empty(t, page.Items)
+
+	body := `{"keys": ["uploads/d.txt", "users/7/c.txt"]}`
+	res = doRequest(t, server, http.MethodPost, "/blobs:batchDelete", strings.NewReader(body), nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var result blob.BatchDeleteResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+	assert.Equal(t, 0, result.Deleted)
+	assert.Equal(t, 2, result.Failed)
+
+	assert.NoError(t, store.Has(ctx, "users/7/c.txt"))
+}
+
+func TestHandler_GetNonExistentBlob(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res := doRequest(t, server, http.MethodGet, "/blobs/missing.json", nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestHandler_PutRejectsBlobAboveStoreLimit(t *testing.T) {
+	store, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{MaxBytes: 8}, newTestLogger())
+	require.NoError(t, err)
+	server := newTestServerWithStore(t, store)
+
+	res := doRequest(t, server, http.MethodPut, "/blobs/big.txt", strings.NewReader("more than eight bytes"), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+}
+
+func TestHandler_PresignBlob(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res := doRequest(t, server, http.MethodPost, "/blobs/report.pdf:presign", nil, nil)
+	assert.Equal(t, http.StatusNotImplemented, res.StatusCode)
+
+	memoryStore, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{}, newTestLogger())
+	require.NoError(t, err)
+	store := &presigningStore{BlobStore: memoryStore}
+	server = newTestServerWithStore(t, store)
+
+	res = doRequest(t, server, http.MethodPost, "/blobs/reports/q3.pdf:presign",
+		strings.NewReader(`{"method": "put", "ttl_seconds": 600, "content_type": "application/pdf"}`), nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var signed blobstore.PresignedRequest
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&signed))
+	assert.Equal(t, "https://storage.example/reports/q3.pdf?signature=test", signed.URL)
+	assert.Equal(t, http.MethodPut, signed.Method)
+	assert.Equal(t, blobstore.PresignOptions{Method: http.MethodPut, TTL: 10 * time.Minute, ContentType: "application/pdf"}, store.opts)
+
+	// an empty body presigns a download with the default TTL
+	res = doRequest(t, server, http.MethodPost, "/blobs/reports/q3.pdf:presign", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, blobstore.PresignOptions{Method: http.MethodGet}, store.opts)
+
+	res = doRequest(t, server, http.MethodPost, "/blobs/reports/q3.pdf:presign", strings.NewReader(`{"method": "DELETE"}`), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestHandler_DeniesRequestsWithoutPrincipal(t *testing.T) {
+	store, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{}, newTestLogger())
+	require.NoError(t, err)
+	require.NoError(t, store.Put(context.Background(), "reports/q3.pdf", []byte("%PDF")))
+	server := newTestServerAs(t, store, nil)
+
+	res := doRequest(t, server, http.MethodGet, "/blobs/reports/q3.pdf", nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs?prefix=reports/", nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodGet, "/blobs?prefix=reports/&archive=zip", nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodPut, "/blobs/reports/q4.pdf", strings.NewReader("%PDF"), nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	assert.ErrorIs(t, store.Has(context.Background(), "reports/q4.pdf"), blobstore.ErrBlobNotFound)
+}
+
+func TestHandler_StoresNothingForTamperedSignedBodies(t *testing.T) {
+	const signingSecret = "0123456789abcdef0123456789abcdef"
+	t.Setenv("TEST_HMAC_SECRET", signingSecret)
+	auth, err := secret.NewHMACSecretStore(secret.HMACConfig{
+		Keys: []secret.HMACKey{{ID: "uploader", SecretEnvVar: "TEST_HMAC_SECRET"}},
+	}, newTestLogger())
+	require.NoError(t, err)
+
+	store, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{}, newTestLogger())
+	require.NoError(t, err)
+	require.NoError(t, store.Put(context.Background(), "docs/draft.md", []byte("draft")))
+	server := newTestServerAs(t, store, nil)
+	server.Config.Handler = secret.NewAPITokenMiddleware(auth, newTestLogger()).Handler(server.Config.Handler)
+
+	// send signs the request for signed but sends sent as its body
+	send := func(method, path, signed, sent string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(signed))
+		require.NoError(t, err)
+		require.NoError(t, secret.SignRequest(req, "uploader", []byte(signingSecret)))
+		req.Body = io.NopCloser(strings.NewReader(sent))
+		req.ContentLength = int64(len(sent))
+
+		res, err := server.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	res := send(http.MethodPost, "/blobs/docs/draft.md:copy", `{"destination": "docs/backup.md"}`, `{"destination": "docs/evil.md"}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.ErrorIs(t, store.Has(context.Background(), "docs/evil.md"), blobstore.ErrBlobNotFound)
+	assert.ErrorIs(t, store.Has(context.Background(), "docs/backup.md"), blobstore.ErrBlobNotFound)
+
+	res = send(http.MethodPut, "/blobs/docs/final.md", "final", "evil!")
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.ErrorIs(t, store.Has(context.Background(), "docs/final.md"), blobstore.ErrBlobNotFound)
+
+	large := strings.Repeat("a", 2<<20)
+	res = send(http.MethodPut, "/blobs/docs/large.bin", large, "b"+large[1:])
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.ErrorIs(t, store.Has(context.Background(), "docs/large.bin"), blobstore.ErrBlobNotFound)
+
+	res = send(http.MethodPut, "/blobs/docs/large.bin", large, large)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	data, err := store.Get(context.Background(), "docs/large.bin")
+	require.NoError(t, err)
+	assert.Equal(t, large, string(data))
+}
+
+func TestHandler_ShareLinks(t *testing.T) {
+	store, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{}, newTestLogger())
+	require.NoError(t, err)
+	require.NoError(t, store.Put(context.Background(), "reports/q3.pdf", []byte("%PDF")))
+
+	server := newTestServerWithStore(t, store)
+	res := doRequest(t, server, http.MethodPost, "/blobs/reports/q3.pdf:share", nil, nil)
+	assert.Equal(t, http.StatusNotImplemented, res.StatusCode)
+
+	signer, err := sharelink.NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	handler := blob.NewHandler(store, newTestLogger())
+	handler.EnableShareLinks(sharelink.Config{BaseURL: "https://files.example/"}, signer)
+
+	mux := http.NewServeMux()
+	mux.Handle("/blobs/{key...}", withPrincipal(http.HandlerFunc(handler.Handle), secret.FullAccess("test")))
+	mux.HandleFunc("/s/{token}", handler.HandleShared)
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	share := func(key, body string) blob.ShareResponse {
+		t.Helper()
+		res := doRequest(t, server, http.MethodPost, "/blobs/"+key+":share", strings.NewReader(body), nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var link blob.ShareResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&link))
+		return link
+	}
+
+	download := share("reports/q3.pdf", `{"ttl_seconds": 300, "filename": "Q3 report.pdf"}`)
+	assert.Equal(t, "https://files.example/s/"+download.Token, download.URL)
+	assert.Equal(t, http.MethodGet, download.Method)
+
+	res = doRequest(t, server, http.MethodGet, "/s/"+download.Token, nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF", string(body))
+	assert.Equal(t, `attachment; filename="Q3 report.pdf"`, res.Header.Get("Content-Disposition"))
+
+	res = doRequest(t, server, http.MethodHead, "/s/"+download.Token, nil, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodPut, "/s/"+download.Token, strings.NewReader("overwrite"), nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodGet, "/s/"+download.Token+"x", nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	upload := share("inbox/scan.png", `{"method": "PUT"}`)
+	res = doRequest(t, server, http.MethodPut, "/s/"+upload.Token+"?extract=zip", strings.NewReader("png"), nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	data, err := store.Get(context.Background(), "inbox/scan.png")
+	require.NoError(t, err)
+	assert.Equal(t, "png", string(data))
+
+	res = doRequest(t, server, http.MethodPost, "/blobs/missing.pdf:share", nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res = doRequest(t, server, http.MethodPost, "/blobs/reports/q3.pdf:share", strings.NewReader(`{"ttl_seconds": 99999999}`), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+// presigningStore records the presign options and returns a fixed URL.
+type presigningStore struct {
+	blobstore.BlobStore
+	opts blobstore.PresignOptions
+}
+
+func (s *presigningStore) Presign(ctx context.Context, key string, opts blobstore.PresignOptions) (blobstore.PresignedRequest, error) {
+	if opts.Method != http.MethodGet && opts.Method != http.MethodPut {
+		return blobstore.PresignedRequest{}, blobstore.ErrInvalidPresignRequest
+	}
+
+	s.opts = opts
+	return blobstore.PresignedRequest{
+		URL:       "https://storage.example/" + key + "?signature=test",
+		Method:    opts.Method,
+		ExpiresAt: time.Now().Add(opts.TTL),
+	}, nil
+}
+
+// failingStore fails every write with err.
+type failingStore struct {
+	blobstore.BlobStore
+	err error
+}
+
+func (s failingStore) PutReader(ctx context.Context, key string, r io.Reader, size int64, opts blobstore.PutOptions) error {
+	return s.err
+}
+
+func (s failingStore) DeleteMany(ctx context.Context, keys []string) ([]blobstore.DeleteResult, error) {
+	results := make([]blobstore.DeleteResult, len(keys))
+	for i, key := range keys {
+		results[i] = blobstore.DeleteResult{Key: key, Err: s.err}
+	}
+	return results, nil
+}
+
+// firstPageStore fails every listing after the first page.
+type firstPageStore struct {
+	blobstore.BlobStore
+}
+
+func (s *firstPageStore) ListPage(ctx context.Context, opts blobstore.ListOptions) (blobstore.ListResult, error) {
+	if opts.Cursor != "" {
+		return blobstore.ListResult{}, errors.New("listing failed")
+	}
+	return s.BlobStore.ListPage(ctx, opts)
+}
+
+// countingStore counts the blob reads that reach the wrapped store.
+type countingStore struct {
+	blobstore.BlobStore
+	reads int
+}
+
+func (s *countingStore) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.reads++
+	return s.BlobStore.GetReader(ctx, key)
+}
+
+// unconditionalStore rejects If-Match like stores without atomic preconditions.
+type unconditionalStore struct {
+	blobstore.BlobStore
+}
+
+func (s *unconditionalStore) PutReader(ctx context.Context, key string, r io.Reader, size int64, opts blobstore.PutOptions) error {
+	if opts.IfMatch != "" {
+		return blobstore.ErrPreconditionNotSupported
+	}
+	return s.BlobStore.PutReader(ctx, key, r, size, opts)
+}
+
+func (s *unconditionalStore) DeleteWithOptions(ctx context.Context, key string, opts blobstore.DeleteOptions) error {
+	if opts.IfMatch != "" {
+		return blobstore.ErrPreconditionNotSupported
+	}
+	return s.BlobStore.DeleteWithOptions(ctx, key, opts)
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *blobstore.MemoryBlobStore) {
+	t.Helper()
+
+	store, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{}, newTestLogger())
+	require.NoError(t, err)
+
+	return newTestServerWithStore(t, store), store
+}
+
+func newTestServerWithStore(t *testing.T, store blobstore.BlobStore) *httptest.Server {
+	t.Helper()
+
+	return newTestServerAs(t, store, secret.FullAccess("test"))
+}
+
+// newTestServerAs serves the blob routes with principal in the request context,
+// like the API token middleware; a nil principal leaves the context without one.
+func newTestServerAs(t *testing.T, store blobstore.BlobStore, principal *secret.Principal) *httptest.Server {
+	t.Helper()
+
+	handler := blob.NewHandler(store, newTestLogger())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blobs", handler.HandleList)
+	mux.HandleFunc("/blobs/{key...}", handler.Handle)
+	mux.HandleFunc("/blobs:batchDelete", handler.HandleBatchDelete)
+
+	var root http.Handler = mux
+	if principal != nil {
+		root = withPrincipal(mux, principal)
+	}
+
+	server := httptest.NewServer(root)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func doRequest(t *testing.T, server *httptest.Server, method, path string, body io.Reader, header http.Header) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+path, body)
+	require.NoError(t, err)
+
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	res, err := server.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+func withPrincipal(next http.Handler, principal *secret.Principal) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(secret.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+func newTestLogger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
@@ -0,0 +1,88 @@
+package blob
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// sniffLen is the number of bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+// acceptsContentType reports whether a blob of the given content type satisfies
+// the Accept header. The most specific matching media range decides, and a
+// quality of zero marks a type as not acceptable (RFC 9110, section 12.5.1).
+func acceptsContentType(accept, contentType string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+	mainType, subType, _ := strings.Cut(mediaType, "/")
+
+	bestSpecificity, bestQuality := -1, 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		rangeType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+
+		rangeMain, rangeSub, _ := strings.Cut(rangeType, "/")
+		specificity := -1
+		switch {
+		case rangeMain == mainType && rangeSub == subType:
+			specificity = 2
+		case rangeMain == mainType && rangeSub == "*":
+			specificity = 1
+		case rangeMain == "*" && rangeSub == "*":
+			specificity = 0
+		}
+
+		if specificity > bestSpecificity {
+			bestSpecificity, bestQuality = specificity, quality
+		}
+	}
+
+	return bestSpecificity >= 0 && bestQuality > 0
+}
+
+// uploadContentType returns the content type declared by the client, or sniffs it
+// from the first bytes of the body. The returned reader must be used instead of
+// the original body, as sniffing consumes from it.
+func uploadContentType(r *http.Request) (string, io.Reader, error) {
+	return detectContentType(r.Header.Get("Content-Type"), r.Body)
+}
+
+// detectContentType validates the declared content type, or sniffs it from the
+// body when it is missing, returning the reader to use in place of body.
+func detectContentType(declared string, body io.Reader) (string, io.Reader, error) {
+	if declared != "" {
+		if _, _, err := mime.ParseMediaType(declared); err != nil {
+			return "", nil, err
+		}
+
+		return declared, body, nil
+	}
+
+	buffered := bufio.NewReaderSize(body, sniffLen)
+	head, err := buffered.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return "", nil, err
+	}
+
+	return http.DetectContentType(head), buffered, nil
+}
@@ -0,0 +1,70 @@
+package blob
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/timgluz/blobber/pkg/blobstore"
+	"github.com/timgluz/blobber/pkg/response"
+	"github.com/timgluz/blobber/pkg/secret"
+)
+
+type presignRequest struct {
+	// Method defaults to GET.
+	Method      string `json:"method"`
+	TTLSeconds  int    `json:"ttl_seconds"`
+	ContentType string `json:"content_type"`
+}
+
+// presignBlob returns a URL for transferring the blob directly with the provider.
+func (h *Handler) presignBlob(w http.ResponseWriter, r *http.Request, key string) {
+	if h.presigner == nil {
+		response.RenderErrorJSON(w, "Presigned URLs are not supported by this store", http.StatusNotImplemented)
+		return
+	}
+
+	var req presignRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxActionBodySize)).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		response.RenderErrorJSON(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	// the URL bypasses the scoped store, so the scopes are checked upfront
+	op := secret.OpRead
+	if method == http.MethodPut {
+		op = secret.OpWrite
+	}
+	if !secret.Allowed(r.Context(), op, key) {
+		h.renderActionError(w, key, "Failed to presign blob URL", secret.ErrForbidden)
+		return
+	}
+
+	signed, err := h.presigner.Presign(r.Context(), key, blobstore.PresignOptions{
+		Method:      method,
+		TTL:         time.Duration(req.TTLSeconds) * time.Second,
+		ContentType: req.ContentType,
+	})
+	if errors.Is(err, blobstore.ErrInvalidPresignRequest) {
+		response.RenderErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.renderActionError(w, key, "Failed to presign blob URL", err)
+		return
+	}
+
+	h.logger.Info("Blob URL presigned", slog.String("key", key), slog.String("method", method),
+		slog.Time("expires_at", signed.ExpiresAt))
+	response.RenderJSON(w, signed)
+}
@@ -0,0 +1,108 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/timgluz/blobber/pkg/blobstore"
+)
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// byteRange is a resolved range of length bytes starting at start.
+type byteRange struct {
+	start, length int64
+}
+
+// contentRange formats the range as a Content-Range header value.
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size)
+}
+
+// requestedRange returns the byte range a GET should serve. ok is false when the
+// full blob should be served: there is no Range header, it is malformed or asks
+// for several ranges, or If-Range no longer matches the blob.
+func requestedRange(r *http.Request, info blobstore.BlobInfo) (br byteRange, ok bool, err error) {
+	header := r.Header.Get("Range")
+	if header == "" || !ifRangeMatches(r.Header.Get("If-Range"), info) {
+		return byteRange{}, false, nil
+	}
+
+	return parseRange(header, info.Size)
+}
+
+// parseRange parses a single byte range against a blob of the given size, see
+// RFC 9110, section 14.1.2. Multiple ranges are not supported and are ignored.
+func parseRange(header string, size int64) (byteRange, bool, error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return byteRange{}, false, nil
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return byteRange{}, false, nil
+	}
+
+	// suffix range, e.g. "bytes=-500" for the last 500 bytes
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return byteRange{}, false, nil
+		}
+		if suffix == 0 || size == 0 {
+			return byteRange{}, false, errRangeNotSatisfiable
+		}
+
+		suffix = min(suffix, size)
+		return byteRange{start: size - suffix, length: suffix}, true, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false, nil
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return byteRange{}, false, nil
+		}
+		end = min(end, size-1)
+	}
+
+	if start >= size {
+		return byteRange{}, false, errRangeNotSatisfiable
+	}
+
+	return byteRange{start: start, length: end - start + 1}, true, nil
+}
+
+// ifRangeMatches reports whether the If-Range validator still matches the blob.
+// Only strong entity tags and exact modification dates match.
+func ifRangeMatches(ifRange string, info blobstore.BlobInfo) bool {
+	ifRange = strings.TrimSpace(ifRange)
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) {
+		return info.ETag != "" && ifRange == strconv.Quote(info.ETag)
+	}
+
+	if strings.HasPrefix(ifRange, "W/") {
+		return false
+	}
+
+	modified, err := http.ParseTime(ifRange)
+	if err != nil || info.LastModified.IsZero() {
+		return false
+	}
+
+	return modified.Equal(info.LastModified.UTC().Truncate(time.Second))
+}
@@ -0,0 +1,184 @@
+package blob
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/timgluz/blobber/pkg/response"
+	"github.com/timgluz/blobber/pkg/secret"
+	"github.com/timgluz/blobber/pkg/sharelink"
+)
+
+const (
+	defaultShareTTL = time.Hour
+	maxShareTTL     = 7 * 24 * time.Hour
+)
+
+type shareRequest struct {
+	// Method defaults to GET, which also allows HEAD.
+	Method     string `json:"method"`
+	TTLSeconds int    `json:"ttl_seconds"`
+	Filename   string `json:"filename"`
+}
+
+type ShareResponse struct {
+	URL       string    `json:"url"`
+	Token     string    `json:"token"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// EnableShareLinks lets the handler mint links with :share and serve them with HandleShared.
+func (h *Handler) EnableShareLinks(config sharelink.Config, signer *sharelink.Signer) {
+	if config.MaxTTL <= 0 {
+		config.MaxTTL = maxShareTTL
+	}
+
+	h.shareConfig = config
+	h.shareSigner = signer
+}
+
+// shareBlob mints a signed link to the blob that works without an API token.
+func (h *Handler) shareBlob(w http.ResponseWriter, r *http.Request, key string) {
+	if h.shareSigner == nil {
+		response.RenderErrorJSON(w, "Share links are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	var req shareRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxActionBodySize)).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		response.RenderErrorJSON(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Filename != "" && mime.FormatMediaType("attachment", map[string]string{"filename": req.Filename}) == "" {
+		response.RenderErrorJSON(w, "filename cannot be used in a Content-Disposition header", http.StatusBadRequest)
+		return
+	}
+
+	method := strings.ToUpper(req.Method)
+	switch method {
+	case "":
+		method = http.MethodGet
+	case http.MethodGet, http.MethodPut:
+	default:
+		response.RenderErrorJSON(w, "method must be GET or PUT", http.StatusBadRequest)
+		return
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if ttl == 0 {
+		ttl = defaultShareTTL
+	}
+	if ttl < 0 || ttl > h.shareConfig.MaxTTL {
+		response.RenderErrorJSON(w, fmt.Sprintf("ttl_seconds must be between 1 and %d", int(h.shareConfig.MaxTTL.Seconds())), http.StatusBadRequest)
+		return
+	}
+
+	// downloads of missing blobs would only fail later; the read scope is
+	// checked by the store
+	if method == http.MethodGet {
+		if err := h.store.Has(r.Context(), key); err != nil {
+			h.renderActionError(w, key, "Failed to share blob", err)
+			return
+		}
+	} else if !secret.Allowed(r.Context(), secret.OpWrite, key) {
+		h.renderActionError(w, key, "Failed to share blob", secret.ErrForbidden)
+		return
+	}
+
+	link := sharelink.Link{
+		Key:       key,
+		Method:    method,
+		Filename:  req.Filename,
+		ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+	}
+
+	token, err := h.shareSigner.Sign(link)
+	if err != nil {
+		h.renderActionError(w, key, "Failed to share blob", err)
+		return
+	}
+
+	h.logger.Info("Share link created", slog.String("key", key), slog.String("method", method),
+		slog.Time("expires_at", link.ExpiresAt))
+	response.RenderJSON(w, ShareResponse{
+		URL:       strings.TrimSuffix(h.shareConfig.BaseURL, "/") + "/s/" + token,
+		Token:     token,
+		Method:    method,
+		ExpiresAt: link.ExpiresAt,
+	})
+}
+
+// attachmentDisposition returns an attachment Content-Disposition with the
+// filename, or a plain attachment when the filename cannot be encoded.
+func attachmentDisposition(filename string) string {
+	if value := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); value != "" {
+		return value
+	}
+
+	return "attachment"
+}
+
+// HandleShared serves /s/{token}. The token is verified on every request and
+// only grants the method it was minted for on its key.
+func (h *Handler) HandleShared(w http.ResponseWriter, r *http.Request) {
+	if h.shareSigner == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	link, err := h.shareSigner.Verify(r.PathValue("token"), time.Now())
+	if err != nil {
+		if errors.Is(err, sharelink.ErrLinkExpired) {
+			http.Error(w, "Share link expired", http.StatusGone)
+			return
+		}
+
+		h.logger.Warn("Rejected share link", slog.String("remote_addr", r.RemoteAddr))
+		http.Error(w, "Invalid share link", http.StatusForbidden)
+		return
+	}
+
+	allowed := link.Method == r.Method || (link.Method == http.MethodGet && r.Method == http.MethodHead)
+	if !allowed {
+		w.Header().Set("Allow", link.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	op := secret.OpRead
+	if link.Method == http.MethodPut {
+		op = secret.OpWrite
+	}
+
+	// the link only covers its key, so query options like extract are dropped
+	// and the store only lets it run the link's operation on that key
+	shared := r.Clone(secret.WithPrincipal(r.Context(), secret.KeyPrincipal("share-link", op, link.Key)))
+	shared.URL.RawQuery = ""
+	shared.SetPathValue("key", link.Key)
+
+	h.logger.Debug("Serving share link", slog.String("key", link.Key), slog.String("method", r.Method))
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if link.Filename != "" {
+			w.Header().Set("Content-Disposition", attachmentDisposition(link.Filename))
+		}
+
+		if r.Method == http.MethodHead {
+			h.headBlob(w, shared)
+		} else {
+			h.getBlob(w, shared)
+		}
+	case http.MethodPut:
+		h.putBlob(w, shared)
+	}
+}
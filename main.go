@@ -7,7 +7,9 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
@@ -17,6 +19,8 @@ import (
 	"github.com/timgluz/blobber/pkg/blobstore"
 	"github.com/timgluz/blobber/pkg/cors"
 	"github.com/timgluz/blobber/pkg/secret"
+	"github.com/timgluz/blobber/pkg/sharelink"
+	"github.com/timgluz/blobber/upload"
 	"gopkg.in/yaml.v2"
 )
 
@@ -32,16 +36,26 @@ type appConfig struct {
 	} `yaml:"log"`
 
 	Store struct {
-		Provider string                   `yaml:"provider"`
-		S3       blobstore.S3Config       `yaml:"s3,omitempty"`
-		GCP      blobstore.GCPConfig      `yaml:"gcp,omitempty"`
-		Azure    blobstore.AzureConfig    `yaml:"azure,omitempty"`
-		Alicloud blobstore.AlicloudConfig `yaml:"alicloud,omitempty"`
+		Provider  string                    `yaml:"provider"`
+		Multipart blobstore.MultipartConfig `yaml:"multipart,omitempty"`
+		S3        blobstore.S3Config        `yaml:"s3,omitempty"`
+		GCP       blobstore.GCPConfig       `yaml:"gcp,omitempty"`
+		Azure     blobstore.AzureConfig     `yaml:"azure,omitempty"`
+		Alicloud  blobstore.AlicloudConfig  `yaml:"alicloud,omitempty"`
+		FS        blobstore.FSConfig        `yaml:"fs,omitempty"`
+		Memory    blobstore.MemoryConfig    `yaml:"memory,omitempty"`
 	} `yaml:"store"`
 
+	Uploads upload.Config    `yaml:"uploads"`
+	Share   sharelink.Config `yaml:"share"`
+
 	Auth struct {
-		Provider       string `yaml:"provider"`
-		APITokenEnvVar string `yaml:"api_token_env_var"`
+		Provider       string            `yaml:"provider"`
+		APITokenEnvVar string            `yaml:"api_token_env_var"`
+		TokensFile     string            `yaml:"tokens_file"`
+		ReloadInterval time.Duration     `yaml:"reload_interval"`
+		JWT            secret.JWTConfig  `yaml:"jwt"`
+		HMAC           secret.HMACConfig `yaml:"hmac"`
 	} `yaml:"auth"`
 }
 
@@ -83,6 +97,10 @@ func main() {
 		return
 	}
 
+	if cleaner, ok := store.(blobstore.MultipartCleaner); ok {
+		go blobstore.RunMultipartCleanup(ctx, cleaner, config.Store.Multipart, logger)
+	}
+
 	authMiddleware, err := initAuthMiddleware(config, logger)
 	if err != nil {
 		fmt.Println("Error initializing auth middleware:", err)
@@ -99,20 +117,59 @@ func main() {
 	blobHandler := blob.NewHandler(store, logger)
 	healthHandler := health.NewHandler(store, logger)
 
+	// the fs store keeps unfinished uploads in its internal directory beside the blobs
+	if config.Uploads.Dir == "" && strings.EqualFold(config.Store.Provider, string(blobstore.BlobStoreTypeFS)) {
+		config.Uploads.Dir = filepath.Join(config.Store.FS.Root, ".blobber", "uploads")
+	}
+
+	var uploadHandler *upload.Handler
+	if config.Uploads.Dir == "" {
+		logger.Warn("Resumable uploads are disabled, uploads.dir is not configured")
+	} else {
+		uploadHandler, err = upload.NewHandler(config.Uploads, store, logger)
+		if err != nil {
+			fmt.Println("Error initializing upload handler:", err)
+			return
+		}
+
+		go uploadHandler.RunCleanup(ctx)
+	}
+
 	// Public routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", homeHandler.Handle)
 	mux.HandleFunc("/healthz", healthHandler.Healthz)
 	mux.HandleFunc("/readyz", healthHandler.Readyz)
 
+	// Share links carry their own signature instead of an API token
+	if config.Share.SecretEnvVar != "" {
+		signer, err := sharelink.NewSigner([]byte(os.Getenv(config.Share.SecretEnvVar)))
+		if err != nil {
+			fmt.Println("Error initializing share links:", err)
+			return
+		}
+
+		blobHandler.EnableShareLinks(config.Share, signer)
+		mux.HandleFunc("/s/{token}", blobHandler.HandleShared)
+	}
+
 	// Protected routes
 	apiMux := http.NewServeMux()
 	apiMux.HandleFunc("/blobs", blobHandler.HandleList)
-	apiMux.HandleFunc("/blobs/{key}", blobHandler.Handle)
+	apiMux.HandleFunc("/blobs/{key...}", blobHandler.Handle)
+	apiMux.HandleFunc("/blobs:batchDelete", blobHandler.HandleBatchDelete)
 
 	// Wrap protected routes with auth middleware
 	mux.Handle("/blobs", authMiddleware.Handler(apiMux))
 	mux.Handle("/blobs/", authMiddleware.Handler(apiMux))
+	mux.Handle("/blobs:batchDelete", authMiddleware.Handler(apiMux))
+
+	if uploadHandler != nil {
+		apiMux.HandleFunc("/uploads", uploadHandler.HandleUploads)
+		apiMux.HandleFunc("/uploads/{id}", uploadHandler.Handle)
+		mux.Handle("/uploads", authMiddleware.Handler(apiMux))
+		mux.Handle("/uploads/", authMiddleware.Handler(apiMux))
+	}
 
 	// add static file server for /static/
 	fileServer := http.FileServer(http.Dir("./static"))
@@ -161,6 +218,29 @@ func initAuthMiddleware(config appConfig, logger *slog.Logger) (*secret.APIToken
 	switch config.Auth.Provider {
 	case string(secret.AuthProviderEnv):
 		store = secret.NewEnvSecretStore(config.Auth.APITokenEnvVar)
+	case string(secret.AuthProviderFile):
+		fileStore, err := secret.NewFileSecretStore(config.Auth.TokensFile, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load API tokens: %w", err)
+		}
+
+		go fileStore.Watch(context.Background(), config.Auth.ReloadInterval)
+		store = fileStore
+	case string(secret.AuthProviderJWT):
+		jwtStore, err := secret.NewJWTSecretStore(context.Background(), config.Auth.JWT, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize JWT auth: %w", err)
+		}
+
+		go jwtStore.Watch(context.Background(), config.Auth.JWT.RefreshInterval)
+		store = jwtStore
+	case string(secret.AuthProviderHMAC):
+		hmacStore, err := secret.NewHMACSecretStore(config.Auth.HMAC, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize request signing: %w", err)
+		}
+
+		store = hmacStore
 	default:
 		logger.Warn("Unknown auth store type, defaulting to env", slog.String("store_type", config.Auth.Provider))
 		return nil, fmt.Errorf("unknown auth store type: %s", config.Auth.Provider)
@@ -179,6 +259,10 @@ func initStore(config appConfig, logger *slog.Logger) (blobstore.BlobStore, erro
 		return initAzureStore(config, logger)
 	case string(blobstore.BlobStoreTypeAlicloud):
 		return initAlicloudStore(config, logger)
+	case string(blobstore.BlobStoreTypeFS):
+		return initFSStore(config, logger)
+	case string(blobstore.BlobStoreTypeMemory):
+		return initMemoryStore(config, logger)
 	default:
 		return nil, fmt.Errorf("unsupported blob provider: %s", config.Store.Provider)
 	}
@@ -201,6 +285,7 @@ func initS3Store(config appConfig, logger *slog.Logger) (blobstore.BlobStore, er
 		fmt.Println("Error creating S3 blob store:", err)
 		return nil, err
 	}
+	store.Multipart = config.Store.Multipart
 
 	return store, nil
 }
@@ -222,6 +307,7 @@ func initGCPStore(config appConfig, logger *slog.Logger) (blobstore.BlobStore, e
 		fmt.Println("Error creating GCP blob store:", err)
 		return nil, err
 	}
+	store.Multipart = config.Store.Multipart
 
 	return store, nil
 }
@@ -243,6 +329,7 @@ func initAzureStore(config appConfig, logger *slog.Logger) (blobstore.BlobStore,
 		fmt.Println("Error creating Azure blob store:", err)
 		return nil, err
 	}
+	store.Multipart = config.Store.Multipart
 
 	return store, nil
 }
@@ -265,6 +352,27 @@ func initAlicloudStore(config appConfig, logger *slog.Logger) (blobstore.BlobSto
 		fmt.Println("Error creating Alicloud blob store:", err)
 		return nil, err
 	}
+	store.Multipart = config.Store.Multipart
+
+	return store, nil
+}
+
+func initFSStore(config appConfig, logger *slog.Logger) (blobstore.BlobStore, error) {
+	store, err := blobstore.NewFSBlobStore(config.Store.FS, logger)
+	if err != nil {
+		fmt.Println("Error creating filesystem blob store:", err)
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func initMemoryStore(config appConfig, logger *slog.Logger) (blobstore.BlobStore, error) {
+	store, err := blobstore.NewMemoryBlobStore(config.Store.Memory, logger)
+	if err != nil {
+		fmt.Println("Error creating in-memory blob store:", err)
+		return nil, err
+	}
 
 	return store, nil
 }
@@ -3,9 +3,12 @@ package blobstore
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/aliyun/alibabacloud-oss-go-sdk-v2/oss"
 	"github.com/aliyun/alibabacloud-oss-go-sdk-v2/oss/credentials"
@@ -34,7 +37,8 @@ type AlicloudConfig struct {
 }
 
 type AlicloudBlobStore struct {
-	Config AlicloudConfig
+	Config    AlicloudConfig
+	Multipart MultipartConfig
 
 	client *oss.Client
 	logger *slog.Logger
@@ -82,7 +86,65 @@ func (s *AlicloudBlobStore) List(ctx context.Context, prefix string) ([]string,
 	return keys, nil
 }
 
+func (s *AlicloudBlobStore) ListPage(ctx context.Context, opts ListOptions) (ListResult, error) {
+	request := &oss.ListObjectsRequest{
+		Bucket:  oss.Ptr(s.Config.Bucket),
+		Prefix:  oss.Ptr(opts.Prefix),
+		MaxKeys: int32(opts.limit()),
+	}
+
+	if opts.Cursor != "" {
+		request.Marker = oss.Ptr(opts.Cursor)
+	}
+
+	if opts.Delimiter != "" {
+		request.Delimiter = oss.Ptr(opts.Delimiter)
+	}
+
+	res, err := s.client.ListObjects(ctx, request)
+	if err != nil {
+		if opts.Cursor != "" && isOSSBadRequest(err) {
+			return ListResult{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+		}
+
+		return ListResult{}, fmt.Errorf("failed to list objects with prefix %s: %w", opts.Prefix, err)
+	}
+
+	var result ListResult
+	for _, object := range res.Contents {
+		if object.Key == nil {
+			continue
+		}
+
+		info := BlobInfo{
+			Key:  oss.ToString(object.Key),
+			Size: object.Size,
+			ETag: normalizeETag(oss.ToString(object.ETag)),
+		}
+
+		if object.LastModified != nil {
+			info.LastModified = *object.LastModified
+		}
+
+		result.Items = append(result.Items, info)
+	}
+
+	for _, commonPrefix := range res.CommonPrefixes {
+		result.Prefixes = append(result.Prefixes, oss.ToString(commonPrefix.Prefix))
+	}
+
+	if res.IsTruncated {
+		result.NextCursor = oss.ToString(res.NextMarker)
+	}
+
+	return result, nil
+}
+
 func (s *AlicloudBlobStore) Has(ctx context.Context, key string) error {
+	if err := alicloudKeyLimit.validate(key); err != nil {
+		return err
+	}
+
 	ok, err := s.client.IsObjectExist(ctx, s.Config.Bucket, key)
 	if err != nil {
 		return fmt.Errorf("failed to check existence of object %s: %w", key, err)
@@ -95,7 +157,42 @@ func (s *AlicloudBlobStore) Has(ctx context.Context, key string) error {
 	return nil
 }
 
+func (s *AlicloudBlobStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	if err := alicloudKeyLimit.validate(key); err != nil {
+		return BlobInfo{}, err
+	}
+
+	res, err := s.client.HeadObject(ctx, &oss.HeadObjectRequest{
+		Bucket: oss.Ptr(s.Config.Bucket),
+		Key:    oss.Ptr(key),
+	})
+	if err != nil {
+		if isOSSNotFound(err) {
+			return BlobInfo{}, ErrBlobNotFound
+		}
+		return BlobInfo{}, fmt.Errorf("failed to stat object %s: %w", key, err)
+	}
+
+	info := BlobInfo{
+		Key:         key,
+		Size:        res.ContentLength,
+		ETag:        normalizeETag(oss.ToString(res.ETag)),
+		ContentType: oss.ToString(res.ContentType),
+		Metadata:    res.Metadata,
+	}
+
+	if res.LastModified != nil {
+		info.LastModified = *res.LastModified
+	}
+
+	return info, nil
+}
+
 func (s *AlicloudBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := alicloudKeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
 	res, err := s.client.GetObject(ctx, &oss.GetObjectRequest{
 		Bucket: oss.Ptr(s.Config.Bucket),
 		Key:    oss.Ptr(key),
@@ -115,6 +212,10 @@ func (s *AlicloudBlobStore) Get(ctx context.Context, key string) ([]byte, error)
 }
 
 func (s *AlicloudBlobStore) Put(ctx context.Context, key string, data []byte) error {
+	if err := alicloudKeyLimit.validate(key); err != nil {
+		return err
+	}
+
 	buf := bytes.NewReader(data)
 
 	_, err := s.client.PutObject(ctx, &oss.PutObjectRequest{
@@ -129,9 +230,188 @@ func (s *AlicloudBlobStore) Put(ctx context.Context, key string, data []byte) er
 	return nil
 }
 
+func (s *AlicloudBlobStore) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := alicloudKeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.GetObject(ctx, &oss.GetObjectRequest{
+		Bucket: oss.Ptr(s.Config.Bucket),
+		Key:    oss.Ptr(key),
+	})
+	if err != nil {
+		if isOSSNotFound(err) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+
+	return res.Body, nil
+}
+
+func (s *AlicloudBlobStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := alicloudKeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.GetObject(ctx, &oss.GetObjectRequest{
+		Bucket: oss.Ptr(s.Config.Bucket),
+		Key:    oss.Ptr(key),
+		Range:  oss.Ptr(httpRange(offset, length)),
+		// fail on invalid ranges instead of silently returning the whole object
+		RangeBehavior: oss.Ptr("standard"),
+	})
+	if err != nil {
+		if isOSSNotFound(err) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("failed to get range of object %s: %w", key, err)
+	}
+
+	return res.Body, nil
+}
+
+func (s *AlicloudBlobStore) PutReader(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	if err := alicloudKeyLimit.validate(key); err != nil {
+		return err
+	}
+
+	// OSS has no If-Match on writes; checking it upfront would race with other writers
+	if opts.IfMatch != "" {
+		return ErrPreconditionNotSupported
+	}
+
+	request := &oss.PutObjectRequest{
+		Bucket: oss.Ptr(s.Config.Bucket),
+		Key:    oss.Ptr(key),
+		Body:   r,
+	}
+
+	if opts.IfNoneMatch {
+		request.ForbidOverwrite = oss.Ptr("true")
+	}
+
+	if size >= 0 {
+		request.ContentLength = oss.Ptr(size)
+	}
+
+	if opts.ContentType != "" {
+		request.ContentType = oss.Ptr(opts.ContentType)
+	}
+
+	config := s.Multipart.withDefaults()
+	if config.useMultipart(size) {
+		return s.putMultipart(ctx, request, r, size, config)
+	}
+
+	if _, err := s.client.PutObject(ctx, request); err != nil {
+		if isOSSObjectExists(err) {
+			return ErrPreconditionFailed
+		}
+		return fmt.Errorf("failed to put object %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// putMultipart uses the SDK uploader, which sends the content in parts and
+// aborts the upload when a part fails.
+func (s *AlicloudBlobStore) putMultipart(ctx context.Context, request *oss.PutObjectRequest, r io.Reader, size int64, config MultipartConfig) error {
+	uploader := s.client.NewUploader(func(o *oss.UploaderOptions) {
+		o.PartSize = config.partSizeFor(size)
+	})
+
+	request.Body = nil
+	if _, err := uploader.UploadFrom(ctx, request, r); err != nil {
+		if isOSSObjectExists(err) {
+			return ErrPreconditionFailed
+		}
+		return fmt.Errorf("failed to upload object %s in parts: %w", oss.ToString(request.Key), err)
+	}
+
+	return nil
+}
+
+// AbortStaleUploads aborts the multipart uploads in the bucket that were started
+// more than olderThan ago.
+func (s *AlicloudBlobStore) AbortStaleUploads(ctx context.Context, olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan)
+
+	aborted := 0
+	paginator := s.client.NewListMultipartUploadsPaginator(&oss.ListMultipartUploadsRequest{
+		Bucket: oss.Ptr(s.Config.Bucket),
+	})
+	for paginator.HasNext() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return aborted, fmt.Errorf("failed to list multipart uploads: %w", err)
+		}
+
+		for _, upload := range page.Uploads {
+			if upload.Initiated == nil || upload.Initiated.After(cutoff) {
+				continue
+			}
+
+			_, err := s.client.AbortMultipartUpload(ctx, &oss.AbortMultipartUploadRequest{
+				Bucket:   oss.Ptr(s.Config.Bucket),
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			})
+			if err != nil {
+				if isOSSNotFound(err) {
+					continue
+				}
+				return aborted, fmt.Errorf("failed to abort multipart upload of %s: %w", oss.ToString(upload.Key), err)
+			}
+
+			aborted++
+		}
+	}
+
+	return aborted, nil
+}
+
+// Copy uses the SDK copier, which switches to a multipart copy for large objects.
+func (s *AlicloudBlobStore) Copy(ctx context.Context, src, dst string) error {
+	for _, key := range []string{src, dst} {
+		if err := alicloudKeyLimit.validate(key); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.client.NewCopier().Copy(ctx, &oss.CopyObjectRequest{
+		Bucket:       oss.Ptr(s.Config.Bucket),
+		Key:          oss.Ptr(dst),
+		SourceBucket: oss.Ptr(s.Config.Bucket),
+		SourceKey:    oss.Ptr(src),
+	})
+	if err != nil {
+		if isOSSNotFound(err) {
+			return ErrBlobNotFound
+		}
+		return fmt.Errorf("failed to copy object %s to %s: %w", src, dst, err)
+	}
+
+	return nil
+}
+
 func (s *AlicloudBlobStore) Delete(ctx context.Context, key string) error {
+	return s.DeleteWithOptions(ctx, key, DeleteOptions{})
+}
+
+// DeleteWithOptions rejects IfMatch with ErrPreconditionNotSupported, as OSS
+// deletes are unconditional.
+func (s *AlicloudBlobStore) DeleteWithOptions(ctx context.Context, key string, opts DeleteOptions) error {
+	if err := alicloudKeyLimit.validate(key); err != nil {
+		return err
+	}
+
+	if opts.IfMatch != "" {
+		return ErrPreconditionNotSupported
+	}
+
 	if err := s.Has(ctx, key); err != nil {
-		return ErrBlobNotFound
+		return err
 	}
 
 	_, err := s.client.DeleteObject(ctx, &oss.DeleteObjectRequest{
@@ -145,3 +425,109 @@ func (s *AlicloudBlobStore) Delete(ctx context.Context, key string) error {
 
 	return nil
 }
+
+func (s *AlicloudBlobStore) DeleteMany(ctx context.Context, keys []string) ([]DeleteResult, error) {
+	if len(keys) > MaxDeleteBatch {
+		return nil, ErrTooManyKeys
+	}
+
+	results, pending := newDeleteResults(keys, alicloudKeyLimit.validate)
+	if len(pending) == 0 {
+		return results, nil
+	}
+
+	objects := make([]oss.DeleteObject, 0, len(pending))
+	for _, i := range pending {
+		objects = append(objects, oss.DeleteObject{Key: oss.Ptr(keys[i])})
+	}
+
+	res, err := s.client.DeleteMultipleObjects(ctx, &oss.DeleteMultipleObjectsRequest{
+		Bucket:  oss.Ptr(s.Config.Bucket),
+		Objects: objects,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete objects: %w", err)
+	}
+
+	// OSS only lists the deleted objects, including the ones that did not exist
+	deleted := make(map[string]bool, len(res.DeletedObjects))
+	for _, info := range res.DeletedObjects {
+		deleted[oss.ToString(info.Key)] = true
+	}
+
+	for _, i := range pending {
+		if !deleted[keys[i]] {
+			results[i].Err = fmt.Errorf("object %s was not deleted", keys[i])
+		}
+	}
+
+	return results, nil
+}
+
+func isOSSNotFound(err error) bool {
+	var serviceErr *oss.ServiceError
+	if !errors.As(err, &serviceErr) {
+		return false
+	}
+
+	return serviceErr.StatusCode == 404
+}
+
+// isOSSBadRequest reports whether a request parameter, like a marker, was rejected.
+func isOSSBadRequest(err error) bool {
+	var serviceErr *oss.ServiceError
+	if !errors.As(err, &serviceErr) {
+		return false
+	}
+
+	return serviceErr.StatusCode == 400
+}
+
+// isOSSObjectExists reports whether a write with x-oss-forbid-overwrite hit an existing object.
+func isOSSObjectExists(err error) bool {
+	var serviceErr *oss.ServiceError
+	if !errors.As(err, &serviceErr) {
+		return false
+	}
+
+	return serviceErr.Code == "FileAlreadyExists"
+}
+
+// Presign signs a GetObject or PutObject request with the credentials of the client.
+func (s *AlicloudBlobStore) Presign(ctx context.Context, key string, opts PresignOptions) (PresignedRequest, error) {
+	if err := alicloudKeyLimit.validate(key); err != nil {
+		return PresignedRequest{}, err
+	}
+
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	var request any = &oss.GetObjectRequest{
+		Bucket: oss.Ptr(s.Config.Bucket),
+		Key:    oss.Ptr(key),
+	}
+	if opts.Method == http.MethodPut {
+		putRequest := &oss.PutObjectRequest{
+			Bucket: oss.Ptr(s.Config.Bucket),
+			Key:    oss.Ptr(key),
+		}
+		if opts.ContentType != "" {
+			putRequest.ContentType = oss.Ptr(opts.ContentType)
+		}
+		request = putRequest
+	}
+
+	result, err := s.client.Presign(ctx, request, oss.PresignExpires(opts.TTL))
+	if err != nil {
+		return PresignedRequest{}, fmt.Errorf("failed to presign %s of object %s: %w", opts.Method, key, err)
+	}
+
+	return PresignedRequest{
+		URL:       result.URL,
+		Method:    result.Method,
+		Headers:   result.SignedHeaders,
+		ExpiresAt: result.Expiration,
+	}, nil
+}
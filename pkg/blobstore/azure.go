@@ -3,15 +3,27 @@ package blobstore
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
 )
 
+// azureCopyPollInterval is how often the status of a pending copy is checked.
+const azureCopyPollInterval = 500 * time.Millisecond
+
 type AzureConfig struct {
 	TenantID  string `yaml:"tenant_id"`
 	Endpoint  string `yaml:"endpoint"` // e.g., "https://<account_name>.blob.core.windows.net/"
@@ -44,6 +56,7 @@ func NewAzureClient(config AzureConfig, credsProvider CredentialsProvider, logge
 
 type AzureBlobStore struct {
 	Container string
+	Multipart MultipartConfig
 
 	client *azblob.Client
 	logger *slog.Logger
@@ -99,7 +112,73 @@ func (s *AzureBlobStore) List(ctx context.Context, prefix string) ([]string, err
 	return keys, nil
 }
 
+func (s *AzureBlobStore) ListPage(ctx context.Context, opts ListOptions) (ListResult, error) {
+	if opts.Delimiter != "" {
+		return s.listHierarchyPage(ctx, opts)
+	}
+
+	listOptions := &container.ListBlobsFlatOptions{
+		Prefix:     &opts.Prefix,
+		MaxResults: to.Ptr(int32(opts.limit())),
+	}
+
+	if opts.Cursor != "" {
+		listOptions.Marker = &opts.Cursor
+	}
+
+	page, err := s.getContainerClient().NewListBlobsFlatPager(listOptions).NextPage(ctx)
+	if err != nil {
+		return ListResult{}, azureListError(err, opts)
+	}
+
+	var result ListResult
+	for _, blobItem := range page.Segment.BlobItems {
+		result.Items = append(result.Items, azureBlobItemInfo(blobItem))
+	}
+
+	if page.NextMarker != nil {
+		result.NextCursor = *page.NextMarker
+	}
+
+	return result, nil
+}
+
+func (s *AzureBlobStore) listHierarchyPage(ctx context.Context, opts ListOptions) (ListResult, error) {
+	listOptions := &container.ListBlobsHierarchyOptions{
+		Prefix:     &opts.Prefix,
+		MaxResults: to.Ptr(int32(opts.limit())),
+	}
+
+	if opts.Cursor != "" {
+		listOptions.Marker = &opts.Cursor
+	}
+
+	page, err := s.getContainerClient().NewListBlobsHierarchyPager(opts.Delimiter, listOptions).NextPage(ctx)
+	if err != nil {
+		return ListResult{}, azureListError(err, opts)
+	}
+
+	var result ListResult
+	for _, blobItem := range page.Segment.BlobItems {
+		result.Items = append(result.Items, azureBlobItemInfo(blobItem))
+	}
+
+	for _, blobPrefix := range page.Segment.BlobPrefixes {
+		result.Prefixes = append(result.Prefixes, *blobPrefix.Name)
+	}
+
+	if page.NextMarker != nil {
+		result.NextCursor = *page.NextMarker
+	}
+
+	return result, nil
+}
+
 func (s *AzureBlobStore) Has(ctx context.Context, key string) error {
+	if err := azureKeyLimit.validate(key); err != nil {
+		return err
+	}
+
 	blobClient := s.getBlobClient(key)
 
 	if _, err := blobClient.GetProperties(ctx, nil); err != nil {
@@ -113,7 +192,49 @@ func (s *AzureBlobStore) Has(ctx context.Context, key string) error {
 	return nil
 }
 
+func (s *AzureBlobStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	if err := azureKeyLimit.validate(key); err != nil {
+		return BlobInfo{}, err
+	}
+
+	props, err := s.getBlobClient(key).GetProperties(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return BlobInfo{}, ErrBlobNotFound
+		}
+
+		return BlobInfo{}, err
+	}
+
+	info := BlobInfo{
+		Key:      key,
+		Metadata: azureMetadata(props.Metadata),
+	}
+
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+
+	if props.ETag != nil {
+		info.ETag = normalizeETag(string(*props.ETag))
+	}
+
+	if props.ContentType != nil {
+		info.ContentType = *props.ContentType
+	}
+
+	if props.LastModified != nil {
+		info.LastModified = *props.LastModified
+	}
+
+	return info, nil
+}
+
 func (s *AzureBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := azureKeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
 	blobClient := s.getBlobClient(key)
 
 	getResp, err := blobClient.DownloadStream(ctx, nil)
@@ -134,6 +255,9 @@ func (s *AzureBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
 }
 
 func (s *AzureBlobStore) Put(ctx context.Context, key string, data []byte) error {
+	if err := azureKeyLimit.validate(key); err != nil {
+		return err
+	}
 
 	_, err := s.client.UploadBuffer(ctx, s.Container, key, data, nil)
 	if err != nil {
@@ -143,11 +267,139 @@ func (s *AzureBlobStore) Put(ctx context.Context, key string, data []byte) error
 	return nil
 }
 
+func (s *AzureBlobStore) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := azureKeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
+	getResp, err := s.getBlobClient(key).DownloadStream(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+
+	// the retry reader resumes the download if the connection drops mid-stream
+	return getResp.NewRetryReader(ctx, nil), nil
+}
+
+func (s *AzureBlobStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := azureKeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
+	// a zero count reads to the end of the blob
+	httpRange := blob.HTTPRange{Offset: offset}
+	if length > 0 {
+		httpRange.Count = length
+	}
+
+	getResp, err := s.getBlobClient(key).DownloadStream(ctx, &blob.DownloadStreamOptions{Range: httpRange})
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+
+	return getResp.NewRetryReader(ctx, nil), nil
+}
+
+func (s *AzureBlobStore) PutReader(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	if err := azureKeyLimit.validate(key); err != nil {
+		return err
+	}
+
+	// UploadStream stages blocks of BlockSize and commits them at the end; content
+	// smaller than one block is sent in a single request. Blocks are buffered in
+	// memory, so they never exceed the part size, even below the multipart
+	// threshold. Uncommitted blocks are discarded by Azure after a week.
+	config := s.Multipart.withDefaults()
+	blockSize := config.PartSize
+	if size >= 0 && size < blockSize {
+		blockSize = size + 1
+	}
+
+	uploadOptions := azblob.UploadStreamOptions{
+		BlockSize:        blockSize,
+		AccessConditions: azureAccessConditions(opts.IfMatch, opts.IfNoneMatch),
+	}
+	if opts.ContentType != "" {
+		uploadOptions.HTTPHeaders = &blob.HTTPHeaders{BlobContentType: &opts.ContentType}
+	}
+
+	_, err := s.client.UploadStream(ctx, s.Container, key, r, &uploadOptions)
+	if err != nil {
+		if isAzurePreconditionFailed(err) || (opts.IfMatch != "" && bloberror.HasCode(err, bloberror.BlobNotFound)) {
+			return ErrPreconditionFailed
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Copy starts a server-side copy and waits until Azure reports it as finished.
+func (s *AzureBlobStore) Copy(ctx context.Context, src, dst string) error {
+	for _, key := range []string{src, dst} {
+		if err := azureKeyLimit.validate(key); err != nil {
+			return err
+		}
+	}
+
+	dstClient := s.getBlobClient(dst)
+	copyResp, err := dstClient.StartCopyFromURL(ctx, s.getBlobClient(src).URL(), nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.CannotVerifyCopySource) {
+			return ErrBlobNotFound
+		}
+		return err
+	}
+
+	status := copyResp.CopyStatus
+	for status != nil && *status == blob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(azureCopyPollInterval):
+		}
+
+		props, err := dstClient.GetProperties(ctx, nil)
+		if err != nil {
+			return err
+		}
+		status = props.CopyStatus
+	}
+
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return fmt.Errorf("copy of %s to %s ended with status %s", src, dst, *status)
+	}
+
+	return nil
+}
+
 func (s *AzureBlobStore) Delete(ctx context.Context, key string) error {
+	return s.DeleteWithOptions(ctx, key, DeleteOptions{})
+}
+
+func (s *AzureBlobStore) DeleteWithOptions(ctx context.Context, key string, opts DeleteOptions) error {
+	if err := azureKeyLimit.validate(key); err != nil {
+		return err
+	}
+
 	blobClient := s.getBlobClient(key)
 
-	if _, err := blobClient.Delete(ctx, nil); err != nil {
+	deleteOptions := &blob.DeleteOptions{AccessConditions: azureAccessConditions(opts.IfMatch, false)}
+	if _, err := blobClient.Delete(ctx, deleteOptions); err != nil {
+		if isAzurePreconditionFailed(err) {
+			return ErrPreconditionFailed
+		}
+
 		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			if opts.IfMatch != "" {
+				return ErrPreconditionFailed
+			}
 			return ErrBlobNotFound
 		}
 		return err
@@ -155,3 +407,149 @@ func (s *AzureBlobStore) Delete(ctx context.Context, key string) error {
 
 	return nil
 }
+
+func azureMetadata(metadata map[string]*string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	result := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		if value != nil {
+			result[key] = *value
+		}
+	}
+
+	return result
+}
+
+func azureBlobItemInfo(item *container.BlobItem) BlobInfo {
+	info := BlobInfo{
+		Key:      *item.Name,
+		Metadata: azureMetadata(item.Metadata),
+	}
+
+	props := item.Properties
+	if props == nil {
+		return info
+	}
+
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+
+	if props.ETag != nil {
+		info.ETag = normalizeETag(string(*props.ETag))
+	}
+
+	if props.ContentType != nil {
+		info.ContentType = *props.ContentType
+	}
+
+	if props.LastModified != nil {
+		info.LastModified = *props.LastModified
+	}
+
+	return info
+}
+
+func (s *AzureBlobStore) DeleteMany(ctx context.Context, keys []string) ([]DeleteResult, error) {
+	if len(keys) > MaxDeleteBatch {
+		return nil, ErrTooManyKeys
+	}
+
+	return deleteConcurrently(ctx, keys, azureKeyLimit.validate, func(ctx context.Context, key string) error {
+		if _, err := s.getBlobClient(key).Delete(ctx, nil); err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return err
+		}
+		return nil
+	}), nil
+}
+
+// azureAccessConditions maps the write preconditions to Azure access conditions,
+// or returns nil when there are none.
+func azureAccessConditions(ifMatch string, ifNoneMatch bool) *blob.AccessConditions {
+	if ifMatch == "" && !ifNoneMatch {
+		return nil
+	}
+
+	conditions := &blob.ModifiedAccessConditions{}
+	if ifMatch != "" {
+		conditions.IfMatch = to.Ptr(azcore.ETag(strconv.Quote(ifMatch)))
+	}
+
+	if ifNoneMatch {
+		conditions.IfNoneMatch = to.Ptr(azcore.ETagAny)
+	}
+
+	return &blob.AccessConditions{ModifiedAccessConditions: conditions}
+}
+
+// azureListError marks a rejected marker as an invalid cursor.
+func azureListError(err error, opts ListOptions) error {
+	if opts.Cursor != "" && bloberror.HasCode(err, bloberror.OutOfRangeInput, bloberror.InvalidQueryParameterValue) {
+		return fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	return err
+}
+
+// isAzurePreconditionFailed reports whether an access condition was not met.
+func isAzurePreconditionFailed(err error) bool {
+	return bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.BlobAlreadyExists)
+}
+
+// Presign returns a user delegation SAS URL, signed with a key obtained through
+// the Azure AD credentials of the client.
+func (s *AzureBlobStore) Presign(ctx context.Context, key string, opts PresignOptions) (PresignedRequest, error) {
+	if err := azureKeyLimit.validate(key); err != nil {
+		return PresignedRequest{}, err
+	}
+
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	// start slightly in the past to tolerate clock skew
+	startsAt := time.Now().UTC().Add(-time.Minute)
+	expiresAt := time.Now().UTC().Add(opts.TTL)
+
+	credential, err := s.client.ServiceClient().GetUserDelegationCredential(ctx, service.KeyInfo{
+		Start:  to.Ptr(startsAt.Format(sas.TimeFormat)),
+		Expiry: to.Ptr(expiresAt.Format(sas.TimeFormat)),
+	}, nil)
+	if err != nil {
+		s.logger.Error("GetUserDelegationCredential failed", slog.String("key", key), slog.Any("error", err))
+		return PresignedRequest{}, err
+	}
+
+	permissions := sas.BlobPermissions{Read: true}
+	headers := opts.contentTypeHeader()
+	if opts.Method == http.MethodPut {
+		permissions = sas.BlobPermissions{Create: true, Write: true}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers["x-ms-blob-type"] = string(blob.BlobTypeBlockBlob)
+	}
+
+	params, err := sas.BlobSignatureValues{
+		Protocol:      sas.ProtocolHTTPS,
+		StartTime:     startsAt,
+		ExpiryTime:    expiresAt,
+		Permissions:   permissions.String(),
+		ContainerName: s.Container,
+		BlobName:      key,
+	}.SignWithUserDelegation(credential)
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	return PresignedRequest{
+		URL:       s.getBlobClient(key).URL() + "?" + params.Encode(),
+		Method:    opts.Method,
+		Headers:   headers,
+		ExpiresAt: expiresAt,
+	}, nil
+}
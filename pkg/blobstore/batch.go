@@ -0,0 +1,62 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// MaxDeleteBatch is the largest number of keys accepted by DeleteMany, matching
+// the limit of the S3 and OSS multi-object delete APIs.
+const MaxDeleteBatch = 1000
+
+// deleteConcurrency bounds the parallel deletes of stores without a batch API.
+const deleteConcurrency = 16
+
+// DeleteResult reports the outcome of deleting a single key; Err is nil on success.
+type DeleteResult struct {
+	Key string
+	Err error
+}
+
+// newDeleteResults returns a result for every key, with the keys that fail
+// validate already marked, and the indexes of the keys left to delete.
+func newDeleteResults(keys []string, validate func(string) error) ([]DeleteResult, []int) {
+	results := make([]DeleteResult, len(keys))
+	pending := make([]int, 0, len(keys))
+	for i, key := range keys {
+		results[i] = DeleteResult{Key: key, Err: validate(key)}
+		if results[i].Err == nil {
+			pending = append(pending, i)
+		}
+	}
+
+	return results, pending
+}
+
+// deleteConcurrently deletes the keys one by one with bounded concurrency, for
+// stores without a batch API. Keys that are already gone count as deleted.
+func deleteConcurrently(ctx context.Context, keys []string, validate func(string) error, deleteFn func(context.Context, string) error) []DeleteResult {
+	results, pending := newDeleteResults(keys, validate)
+
+	sem := make(chan struct{}, deleteConcurrency)
+	var wg sync.WaitGroup
+	for _, i := range pending {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			if err := ctx.Err(); err != nil {
+				results[i].Err = err
+				return
+			}
+
+			if err := deleteFn(ctx, keys[i]); err != nil && !errors.Is(err, ErrBlobNotFound) {
+				results[i].Err = err
+			}
+		})
+	}
+	wg.Wait()
+
+	return results
+}
@@ -1,6 +1,11 @@
 package blobstore
 
-import "context"
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+)
 
 type BlobStoreType string
 
@@ -9,17 +14,74 @@ const (
 	BlobStoreTypeGCP      BlobStoreType = "gcp"
 	BlobStoreTypeAzure    BlobStoreType = "azure"
 	BlobStoreTypeAlicloud BlobStoreType = "alicloud"
+	BlobStoreTypeFS       BlobStoreType = "fs"
+	BlobStoreTypeMemory   BlobStoreType = "memory"
 )
 
+// BlobInfo describes a stored blob without its content.
+type BlobInfo struct {
+	Key          string            `json:"key"`
+	Size         int64             `json:"size"`
+	ETag         string            `json:"etag,omitempty"` // without surrounding quotes
+	ContentType  string            `json:"content_type,omitempty"`
+	LastModified time.Time         `json:"last_modified,omitzero"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// PutOptions carries optional attributes stored along with a blob and the
+// preconditions for the write. A failed precondition returns ErrPreconditionFailed;
+// stores that cannot check IfMatch atomically return ErrPreconditionNotSupported.
+type PutOptions struct {
+	ContentType string
+	// IfMatch only writes when the current blob has this ETag.
+	IfMatch string
+	// IfNoneMatch only writes when no blob exists under the key.
+	IfNoneMatch bool
+}
+
+// DeleteOptions carries the preconditions for a delete.
+type DeleteOptions struct {
+	// IfMatch only deletes when the current blob has this ETag.
+	IfMatch string
+}
+
 type BlobStore interface {
 	// Ping checks the connectivity to the blob store.
 	Ping(context.Context) error
 	// List returns a list of blob keys with the given prefix.
 	List(context context.Context, prefix string) ([]string, error)
+	// ListPage returns a single page of blobs with their attributes, continuing from opts.Cursor.
+	ListPage(ctx context.Context, opts ListOptions) (ListResult, error)
 
 	// Has checks if a blob with the given key exists.
 	Has(context.Context, string) error
+	// Stat returns the metadata of a blob, or ErrBlobNotFound.
+	Stat(ctx context.Context, key string) (BlobInfo, error)
 	Get(context context.Context, key string) ([]byte, error)
 	Put(context context.Context, key string, data []byte) error
 	Delete(context context.Context, key string) error
+	// DeleteMany deletes up to MaxDeleteBatch blobs and reports the outcome per key.
+	// Keys that do not exist count as deleted. The error is only set when the
+	// whole batch failed.
+	DeleteMany(ctx context.Context, keys []string) ([]DeleteResult, error)
+	// Copy copies a blob within the store without routing the content through
+	// the server, overwriting dst. It returns ErrBlobNotFound when src is missing.
+	Copy(ctx context.Context, src, dst string) error
+	// DeleteWithOptions deletes a blob if the preconditions in opts hold.
+	DeleteWithOptions(ctx context.Context, key string, opts DeleteOptions) error
+
+	// GetReader streams the content of a blob; the caller must close the reader.
+	GetReader(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange streams length bytes of a blob starting at offset; a negative
+	// length reads to the end. The caller must close the reader.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// PutReader streams content into a blob. Size is the content length in bytes,
+	// or -1 when it is not known upfront.
+	PutReader(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error
+}
+
+// normalizeETag strips the quotes and weak marker providers put around ETags.
+func normalizeETag(etag string) string {
+	etag = strings.TrimPrefix(etag, "W/")
+	return strings.Trim(etag, `"`)
 }
@@ -0,0 +1,22 @@
+package blobstore
+
+import "errors"
+
+// checkPreconditions evaluates the IfMatch and IfNoneMatch preconditions against
+// the result of a Stat, for stores that cannot enforce them natively.
+func checkPreconditions(info BlobInfo, statErr error, ifMatch string, ifNoneMatch bool) error {
+	if statErr != nil && !errors.Is(statErr, ErrBlobNotFound) {
+		return statErr
+	}
+
+	exists := statErr == nil
+	if ifNoneMatch && exists {
+		return ErrPreconditionFailed
+	}
+
+	if ifMatch != "" && (!exists || info.ETag != normalizeETag(ifMatch)) {
+		return ErrPreconditionFailed
+	}
+
+	return nil
+}
@@ -3,11 +3,19 @@ package blobstore
 import "errors"
 
 var (
-	ErrNoValidCredentials = errors.New("no valid credentials provided")
-	ErrConfigLoadFailed   = errors.New("failed to load configuration")
-	ErrBlobNotFound       = errors.New("blob not found")
-	ErrBucketNotFound     = errors.New("bucket not found")
-	ErrNoValidBucket      = errors.New("no valid bucket provided")
-	ErrNoValidBlobClient  = errors.New("no valid blob client provided")
-	ErrNoValidLogger      = errors.New("no valid logger provided")
+	ErrNoValidCredentials       = errors.New("no valid credentials provided")
+	ErrConfigLoadFailed         = errors.New("failed to load configuration")
+	ErrBlobNotFound             = errors.New("blob not found")
+	ErrBucketNotFound           = errors.New("bucket not found")
+	ErrNoValidBucket            = errors.New("no valid bucket provided")
+	ErrNoValidBlobClient        = errors.New("no valid blob client provided")
+	ErrNoValidLogger            = errors.New("no valid logger provided")
+	ErrNoValidRoot              = errors.New("no valid root directory provided")
+	ErrInvalidKey               = errors.New("invalid blob key")
+	ErrBlobTooLarge             = errors.New("blob exceeds store capacity")
+	ErrInvalidCursor            = errors.New("invalid list cursor")
+	ErrPreconditionFailed       = errors.New("blob precondition failed")
+	ErrPreconditionNotSupported = errors.New("blob precondition not supported by the store")
+	ErrTooManyKeys              = errors.New("too many keys in batch")
+	ErrInvalidPresignRequest    = errors.New("invalid presign request")
 )
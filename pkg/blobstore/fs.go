@@ -0,0 +1,586 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fsInternalDir holds the store's own bookkeeping files (temp files, metadata)
+// and is never exposed as a blob key.
+const fsInternalDir = ".blobber"
+
+// fsMetadata is persisted for every blob in a tree under fsInternalDir/meta
+// that mirrors the blob keys.
+type fsMetadata struct {
+	ContentType string `json:"content_type,omitempty"`
+	// ETag is the MD5 of the content, valid while the file still has the
+	// recorded size and modification time.
+	ETag    string    `json:"etag,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time,omitzero"`
+}
+
+type FSConfig struct {
+	Root string `yaml:"root"`
+}
+
+type FSBlobStore struct {
+	Root string
+
+	root   *os.Root
+	logger *slog.Logger
+
+	// mu serializes commits and deletes so preconditions are checked atomically
+	mu sync.Mutex
+}
+
+func NewFSBlobStore(config FSConfig, logger *slog.Logger) (*FSBlobStore, error) {
+	if strings.TrimSpace(config.Root) == "" {
+		return nil, ErrNoValidRoot
+	}
+
+	if logger == nil {
+		return nil, ErrNoValidLogger
+	}
+
+	rootPath, err := filepath.Abs(config.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range []string{"tmp", "meta"} {
+		if err := os.MkdirAll(filepath.Join(rootPath, fsInternalDir, dir), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := os.OpenRoot(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FSBlobStore{
+		Root:   rootPath,
+		root:   root,
+		logger: logger,
+	}, nil
+}
+
+// Close releases the handle on the root directory.
+func (s *FSBlobStore) Close() error {
+	return s.root.Close()
+}
+
+func (s *FSBlobStore) Ping(ctx context.Context) error {
+	info, err := s.root.Stat(".")
+	if err != nil {
+		s.logger.Error("Failed to stat root directory", slog.String("root", s.Root), slog.Any("error", err))
+		return err
+	}
+
+	if !info.IsDir() {
+		return ErrNoValidRoot
+	}
+
+	return nil
+}
+
+func (s *FSBlobStore) List(ctx context.Context, prefix string) ([]string, error) {
+	s.logger.Debug("List", slog.String("prefix", prefix))
+
+	var keys []string
+	err := fs.WalkDir(s.root.FS(), s.walkStart(prefix), func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if name == fsInternalDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.Type().IsRegular() && strings.HasPrefix(name, prefix) {
+			keys = append(keys, name)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		s.logger.Error("List failed", slog.String("prefix", prefix), slog.Any("error", err))
+		return nil, err
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *FSBlobStore) ListPage(ctx context.Context, opts ListOptions) (ListResult, error) {
+	keys, err := s.List(ctx, opts.Prefix)
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	result, err := pageSortedKeys(keys, opts)
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	if opts.Details {
+		statItems(ctx, s, result.Items)
+	}
+	return result, nil
+}
+
+func (s *FSBlobStore) Has(ctx context.Context, key string) error {
+	name, err := s.keyPath(key)
+	if err != nil {
+		return err
+	}
+
+	info, err := s.root.Stat(name)
+	if err != nil || !info.Mode().IsRegular() {
+		return ErrBlobNotFound
+	}
+
+	return nil
+}
+
+func (s *FSBlobStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	name, err := s.keyPath(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+
+	info, err := s.root.Stat(name)
+	if err != nil || !info.Mode().IsRegular() {
+		return BlobInfo{}, ErrBlobNotFound
+	}
+
+	metadata := s.readMetadata(name)
+	contentType := metadata.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+
+	etag := metadata.ETag
+	if etag == "" || metadata.Size != info.Size() || !metadata.ModTime.Equal(info.ModTime()) {
+		// the file was written around the store, so its content is hashed instead
+		if etag, err = s.hashFile(name); err != nil {
+			s.logger.Error("Hashing file failed", slog.String("key", key), slog.Any("error", err))
+			return BlobInfo{}, err
+		}
+	}
+
+	return BlobInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ETag:         etag,
+		ContentType:  contentType,
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (s *FSBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.logger.Debug("Get", slog.String("key", key))
+
+	name, err := s.keyPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.root.ReadFile(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrBlobNotFound
+		}
+
+		s.logger.Error("ReadFile failed", slog.String("key", key), slog.Any("error", err))
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *FSBlobStore) Put(ctx context.Context, key string, data []byte) error {
+	return s.PutReader(ctx, key, bytes.NewReader(data), int64(len(data)), PutOptions{})
+}
+
+func (s *FSBlobStore) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.logger.Debug("GetReader", slog.String("key", key))
+
+	name, err := s.keyPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := s.root.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrBlobNotFound
+		}
+
+		s.logger.Error("Open failed", slog.String("key", key), slog.Any("error", err))
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		file.Close()
+		return nil, ErrBlobNotFound
+	}
+
+	return file, nil
+}
+
+func (s *FSBlobStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	s.logger.Debug("GetRange", slog.String("key", key), slog.Int64("offset", offset), slog.Int64("length", length))
+
+	reader, err := s.GetReader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	file := reader.(*os.File)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if length < 0 {
+		return file, nil
+	}
+
+	return readCloser{io.LimitReader(file, length), file}, nil
+}
+
+func (s *FSBlobStore) PutReader(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	s.logger.Debug("PutReader", slog.String("key", key), slog.Int64("size", size))
+
+	name, err := s.keyPath(key)
+	if err != nil {
+		return err
+	}
+
+	tmpName, etag, err := s.writeTemp(r)
+	if err != nil {
+		s.logger.Error("Writing temp file failed", slog.String("key", key), slog.Any("error", err))
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if opts.IfMatch != "" || opts.IfNoneMatch {
+		current, err := s.Stat(ctx, key)
+		if err := checkPreconditions(current, err, opts.IfMatch, opts.IfNoneMatch); err != nil {
+			s.root.Remove(tmpName)
+			return err
+		}
+	}
+
+	if err := s.commit(tmpName, name); err != nil {
+		s.logger.Error("PutReader failed", slog.String("key", key), slog.Any("error", err))
+		return err
+	}
+
+	if err := s.writeMetadata(name, s.stamp(name, fsMetadata{ContentType: opts.ContentType}, etag)); err != nil {
+		s.logger.Error("Writing metadata failed", slog.String("key", key), slog.Any("error", err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *FSBlobStore) DeleteMany(ctx context.Context, keys []string) ([]DeleteResult, error) {
+	if len(keys) > MaxDeleteBatch {
+		return nil, ErrTooManyKeys
+	}
+
+	return deleteConcurrently(ctx, keys, ValidateKey, s.Delete), nil
+}
+
+func (s *FSBlobStore) Copy(ctx context.Context, src, dst string) error {
+	s.logger.Debug("Copy", slog.String("src", src), slog.String("dst", dst))
+
+	srcName, err := s.keyPath(src)
+	if err != nil {
+		return err
+	}
+
+	dstName, err := s.keyPath(dst)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Has(ctx, src); err != nil {
+		return err
+	}
+
+	file, err := s.root.Open(srcName)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrBlobNotFound
+		}
+		return err
+	}
+	defer file.Close()
+
+	tmpName, etag, err := s.writeTemp(file)
+	if err != nil {
+		s.logger.Error("Writing temp file failed", slog.String("key", dst), slog.Any("error", err))
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.commit(tmpName, dstName); err != nil {
+		s.logger.Error("Copy failed", slog.String("src", src), slog.String("dst", dst), slog.Any("error", err))
+		return err
+	}
+
+	metadata := fsMetadata{ContentType: s.readMetadata(srcName).ContentType}
+	return s.writeMetadata(dstName, s.stamp(dstName, metadata, etag))
+}
+
+func (s *FSBlobStore) Delete(ctx context.Context, key string) error {
+	return s.DeleteWithOptions(ctx, key, DeleteOptions{})
+}
+
+func (s *FSBlobStore) DeleteWithOptions(ctx context.Context, key string, opts DeleteOptions) error {
+	s.logger.Debug("Delete", slog.String("key", key))
+
+	name, err := s.keyPath(key)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.Stat(ctx, key)
+	if opts.IfMatch != "" {
+		err = checkPreconditions(current, err, opts.IfMatch, false)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.root.Remove(name); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrBlobNotFound
+		}
+
+		s.logger.Error("Remove failed", slog.String("key", key), slog.Any("error", err))
+		return err
+	}
+
+	s.removeEmptyParents(name, ".")
+
+	if err := s.root.Remove(fsMetadataPath(name)); err == nil {
+		s.removeEmptyParents(fsMetadataPath(name), path.Join(fsInternalDir, "meta"))
+	}
+
+	return nil
+}
+
+// keyPath maps a blob key onto a slash separated path relative to the root and
+// rejects keys that would escape it or clash with the internal directory.
+func (s *FSBlobStore) keyPath(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+
+	if !filepath.IsLocal(filepath.FromSlash(key)) || path.Clean(key) != key {
+		return "", ErrInvalidKey
+	}
+
+	if key == fsInternalDir || strings.HasPrefix(key, fsInternalDir+"/") {
+		return "", ErrInvalidKey
+	}
+
+	return key, nil
+}
+
+// walkStart returns the deepest directory that contains every key with the prefix.
+func (s *FSBlobStore) walkStart(prefix string) string {
+	idx := strings.LastIndex(prefix, "/")
+	if idx <= 0 {
+		return "."
+	}
+
+	dir := path.Clean(prefix[:idx])
+	if !fs.ValidPath(dir) {
+		return "."
+	}
+
+	return dir
+}
+
+// writeTemp writes r to a new temp file and returns its name and the ETag of the content.
+func (s *FSBlobStore) writeTemp(r io.Reader) (string, string, error) {
+	tmpName, file, err := s.createTemp()
+	if err != nil {
+		return "", "", err
+	}
+
+	checksum := md5.New()
+	if _, err := io.Copy(io.MultiWriter(file, checksum), r); err != nil {
+		file.Close()
+		s.root.Remove(tmpName)
+		return "", "", err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		s.root.Remove(tmpName)
+		return "", "", err
+	}
+
+	if err := file.Close(); err != nil {
+		s.root.Remove(tmpName)
+		return "", "", err
+	}
+
+	return tmpName, hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+// hashFile returns the ETag of a blob without recorded metadata.
+func (s *FSBlobStore) hashFile(name string) (string, error) {
+	file, err := s.root.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	checksum := md5.New()
+	if _, err := io.Copy(checksum, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+// stamp records the ETag of a committed blob together with its size and
+// modification time, which tell Stat whether the file changed since.
+func (s *FSBlobStore) stamp(name string, metadata fsMetadata, etag string) fsMetadata {
+	info, err := s.root.Stat(name)
+	if err != nil {
+		return metadata
+	}
+
+	metadata.ETag = etag
+	metadata.Size = info.Size()
+	metadata.ModTime = info.ModTime()
+	return metadata
+}
+
+func (s *FSBlobStore) createTemp() (string, *os.File, error) {
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", nil, err
+	}
+
+	tmpName := path.Join(fsInternalDir, "tmp", hex.EncodeToString(suffix))
+	file, err := s.root.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return tmpName, file, nil
+}
+
+// commit atomically moves a finished temp file to its final location.
+func (s *FSBlobStore) commit(tmpName, name string) error {
+	if dir := path.Dir(name); dir != "." {
+		if err := s.root.MkdirAll(dir, 0o755); err != nil {
+			s.root.Remove(tmpName)
+			return err
+		}
+	}
+
+	if err := s.root.Rename(tmpName, name); err != nil {
+		s.root.Remove(tmpName)
+		return err
+	}
+
+	return nil
+}
+
+func (s *FSBlobStore) readMetadata(name string) fsMetadata {
+	var metadata fsMetadata
+
+	content, err := s.root.ReadFile(fsMetadataPath(name))
+	if err != nil {
+		return metadata
+	}
+
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		s.logger.Warn("Ignoring corrupt metadata", slog.String("key", name), slog.Any("error", err))
+	}
+
+	return metadata
+}
+
+// writeMetadata replaces the metadata of a blob; empty metadata removes the file.
+func (s *FSBlobStore) writeMetadata(name string, metadata fsMetadata) error {
+	metaName := fsMetadataPath(name)
+	if metadata == (fsMetadata{}) {
+		if err := s.root.Remove(metaName); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	tmpName, _, err := s.writeTemp(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	return s.commit(tmpName, metaName)
+}
+
+func fsMetadataPath(name string) string {
+	return path.Join(fsInternalDir, "meta", name)
+}
+
+// removeEmptyParents cleans up directories left empty after a delete, up to stop.
+func (s *FSBlobStore) removeEmptyParents(name, stop string) {
+	for dir := path.Dir(name); dir != stop && dir != "."; dir = path.Dir(dir) {
+		// Remove fails on non-empty directories, which ends the walk up.
+		if err := s.root.Remove(dir); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package blobstore_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timgluz/blobber/pkg/blobstore"
+)
+
+func TestFSBlobStore_CRUD(t *testing.T) {
+	store := newTestFSStore(t)
+	ctx := context.Background()
+
+	testKey := "users/42/put_test.json"
+	testData := []byte(`{"put": "test"}`)
+
+	err := store.Put(ctx, testKey, testData)
+	require.NoError(t, err, "failed to put data")
+
+	require.NoError(t, store.Has(ctx, testKey))
+
+	info, err := store.Stat(ctx, testKey)
+	require.NoError(t, err)
+	assert.Equal(t, testKey, info.Key)
+	assert.Equal(t, int64(len(testData)), info.Size)
+	assert.NotEmpty(t, info.ETag)
+	assert.False(t, info.LastModified.IsZero())
+
+	retrievedData, err := store.Get(ctx, testKey)
+	require.NoError(t, err, "failed to get data after put")
+	assert.Equal(t, testData, retrievedData)
+
+	err = store.Delete(ctx, testKey)
+	require.NoError(t, err, "failed to delete test data")
+
+	assert.ErrorIs(t, store.Has(ctx, testKey), blobstore.ErrBlobNotFound)
+	assert.ErrorIs(t, store.Delete(ctx, testKey), blobstore.ErrBlobNotFound)
+
+	_, err = os.Stat(filepath.Join(store.Root, "users"))
+	assert.True(t, os.IsNotExist(err), "empty parent directories should be removed")
+}
+
+func TestFSBlobStore_StreamingCRUD(t *testing.T) {
+	store := newTestFSStore(t)
+	ctx := context.Background()
+
+	testData := strings.Repeat("streamed content ", 1024)
+	err := store.PutReader(ctx, "stream.txt", strings.NewReader(testData), -1, blobstore.PutOptions{ContentType: "text/x-custom"})
+	require.NoError(t, err, "failed to put data from reader")
+
+	info, err := store.Stat(ctx, "stream.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/x-custom", info.ContentType)
+
+	reader, err := store.GetReader(ctx, "stream.txt")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	retrievedData, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, testData, string(retrievedData))
+
+	_, err = store.GetReader(ctx, "missing.txt")
+	assert.ErrorIs(t, err, blobstore.ErrBlobNotFound)
+}
+
+func TestFSBlobStore_GetRange(t *testing.T) {
+	store := newTestFSStore(t)
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, "digits.txt", []byte("0123456789")))
+
+	for _, tt := range []struct {
+		offset, length int64
+		expected       string
+	}{
+		{0, 3, "012"},
+		{4, 2, "45"},
+		{7, -1, "789"},
+	} {
+		reader, err := store.GetRange(ctx, "digits.txt", tt.offset, tt.length)
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, string(data))
+	}
+
+	_, err := store.GetRange(ctx, "missing.txt", 0, 1)
+	assert.ErrorIs(t, err, blobstore.ErrBlobNotFound)
+}
+
+func TestFSBlobStore_ConditionalWrites(t *testing.T) {
+	store := newTestFSStore(t)
+	ctx := context.Background()
+
+	createOnly := blobstore.PutOptions{IfNoneMatch: true}
+	require.NoError(t, store.PutReader(ctx, "state.json", strings.NewReader("v1"), -1, createOnly))
+
+	err := store.PutReader(ctx, "state.json", strings.NewReader("v2"), -1, createOnly)
+	assert.ErrorIs(t, err, blobstore.ErrPreconditionFailed)
+
+	info, err := store.Stat(ctx, "state.json")
+	require.NoError(t, err)
+
+	err = store.PutReader(ctx, "state.json", strings.NewReader("v2"), -1, blobstore.PutOptions{IfMatch: "stale"})
+	assert.ErrorIs(t, err, blobstore.ErrPreconditionFailed)
+
+	err = store.DeleteWithOptions(ctx, "state.json", blobstore.DeleteOptions{IfMatch: "stale"})
+	assert.ErrorIs(t, err, blobstore.ErrPreconditionFailed)
+
+	require.NoError(t, store.DeleteWithOptions(ctx, "state.json", blobstore.DeleteOptions{IfMatch: info.ETag}))
+
+	err = store.DeleteWithOptions(ctx, "state.json", blobstore.DeleteOptions{IfMatch: info.ETag})
+	assert.ErrorIs(t, err, blobstore.ErrPreconditionFailed)
+
+	entries, err := os.ReadDir(filepath.Join(store.Root, ".blobber", "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "rejected writes must not leave temp files behind")
+}
+
+func TestFSBlobStore_ETagFollowsContent(t *testing.T) {
+	store := newTestFSStore(t)
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, "state.json", []byte("v1")))
+	first, err := store.Stat(ctx, "state.json")
+	require.NoError(t, err)
+	assert.Equal(t, "6654c734ccab8f440ff0825eb443dc7f", first.ETag, "the ETag is the MD5 of the content")
+
+	// a rewrite of the same size within the same clock tick must still change the ETag
+	require.NoError(t, store.Put(ctx, "state.json", []byte("v2")))
+	second, err := store.Stat(ctx, "state.json")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ETag, second.ETag)
+
+	err = store.PutReader(ctx, "state.json", strings.NewReader("v3"), -1, blobstore.PutOptions{IfMatch: first.ETag})
+	assert.ErrorIs(t, err, blobstore.ErrPreconditionFailed)
+
+	// files changed around the store are hashed instead of trusting stale metadata
+	require.NoError(t, os.WriteFile(filepath.Join(store.Root, "state.json"), []byte("v1"), 0o644))
+	third, err := store.Stat(ctx, "state.json")
+	require.NoError(t, err)
+	assert.Equal(t, first.ETag, third.ETag)
+}
+
+func TestFSBlobStore_Copy(t *testing.T) {
+	store := newTestFSStore(t)
+	ctx := context.Background()
+
+	err := store.PutReader(ctx, "src.txt", strings.NewReader("copy me"), -1, blobstore.PutOptions{ContentType: "text/x-custom"})
+	require.NoError(t, err)
+
+	require.NoError(t, store.Copy(ctx, "src.txt", "nested/dst.txt"))
+
+	data, err := store.Get(ctx, "nested/dst.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "copy me", string(data))
+
+	info, err := store.Stat(ctx, "nested/dst.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/x-custom", info.ContentType)
+
+	assert.ErrorIs(t, store.Copy(ctx, "missing.txt", "dst.txt"), blobstore.ErrBlobNotFound)
+	assert.ErrorIs(t, store.Copy(ctx, "nested", "dst.txt"), blobstore.ErrBlobNotFound)
+}
+
+func TestFSBlobStore_Get_NonExistentKey(t *testing.T) {
+	store := newTestFSStore(t)
+
+	_, err := store.Get(context.Background(), "nonexistent.json")
+	assert.ErrorIs(t, err, blobstore.ErrBlobNotFound)
+}
+
+func TestFSBlobStore_List(t *testing.T) {
+	store := newTestFSStore(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"test.json", "users/1/a.txt", "users/2/b.txt", "other.txt"} {
+		require.NoError(t, store.Put(ctx, key, []byte(key)))
+	}
+
+	keys, err := store.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other.txt", "test.json", "users/1/a.txt", "users/2/b.txt"}, keys)
+
+	keys, err = store.List(ctx, "users/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users/1/a.txt", "users/2/b.txt"}, keys)
+
+	keys, err = store.List(ctx, "te")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test.json"}, keys)
+
+	keys, err = store.List(ctx, "missing/")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestFSBlobStore_RejectsPathTraversal(t *testing.T) {
+	store := newTestFSStore(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"../escape.txt", "a/../../escape.txt", "/etc/passwd", "a//b", ".blobber/tmp/x", "dir/"} {
+		err := store.Put(ctx, key, []byte("nope"))
+		assert.ErrorIs(t, err, blobstore.ErrInvalidKey, "key %q should be rejected", key)
+	}
+
+	_, err := os.Stat(filepath.Join(filepath.Dir(store.Root), "escape.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func newTestFSStore(t *testing.T) *blobstore.FSBlobStore {
+	t.Helper()
+
+	store, err := blobstore.NewFSBlobStore(blobstore.FSConfig{Root: t.TempDir()}, initTestLogger(t))
+	require.NoError(t, err, "failed to create filesystem blob store")
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
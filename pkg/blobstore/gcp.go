@@ -2,11 +2,14 @@ package blobstore
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
@@ -51,7 +54,8 @@ func NewGCPClient(config GCPConfig, credsProvider CredentialsProvider, logger *s
 }
 
 type GCPBlobStore struct {
-	Bucket string
+	Bucket    string
+	Multipart MultipartConfig
 
 	client *storage.Client
 	logger *slog.Logger
@@ -85,19 +89,49 @@ func (s *GCPBlobStore) Ping(ctx context.Context) error {
 }
 
 func (s *GCPBlobStore) Has(ctx context.Context, key string) error {
+	if err := gcpKeyLimit.validate(key); err != nil {
+		return err
+	}
+
 	defer ctx.Done()
 
 	bucket := s.client.Bucket(s.Bucket)
 	obj := bucket.Object(key)
 	if _, err := obj.Attrs(ctx); err != nil {
-		s.logger.Error("object does not exist", slog.String("key", key), slog.Any("error", err))
-		return ErrBlobNotFound
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return ErrBlobNotFound
+		}
+
+		s.logger.Error("reading object attributes failed", slog.String("key", key), slog.Any("error", err))
+		return fmt.Errorf("reading attributes of %q: %w", key, err)
 	}
 
 	return nil
 }
 
+func (s *GCPBlobStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	if err := gcpKeyLimit.validate(key); err != nil {
+		return BlobInfo{}, err
+	}
+
+	attrs, err := s.client.Bucket(s.Bucket).Object(key).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return BlobInfo{}, ErrBlobNotFound
+		}
+
+		s.logger.Error("reading object attributes failed", slog.String("key", key), slog.Any("error", err))
+		return BlobInfo{}, err
+	}
+
+	return gcpBlobInfo(attrs), nil
+}
+
 func (s *GCPBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := gcpKeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
 	defer ctx.Done()
 
 	bucket := s.client.Bucket(s.Bucket)
@@ -130,6 +164,10 @@ func (s *GCPBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
 }
 
 func (s *GCPBlobStore) Put(ctx context.Context, key string, data []byte) error {
+	if err := gcpKeyLimit.validate(key); err != nil {
+		return err
+	}
+
 	defer ctx.Done()
 
 	bucket := s.client.Bucket(s.Bucket)
@@ -145,17 +183,148 @@ func (s *GCPBlobStore) Put(ctx context.Context, key string, data []byte) error {
 	return nil
 }
 
+func (s *GCPBlobStore) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := gcpKeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
+	reader, err := s.client.Bucket(s.Bucket).Object(key).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, ErrBlobNotFound
+		}
+
+		s.logger.Error("getting object reader failed", slog.String("key", key), slog.Any("error", err))
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+func (s *GCPBlobStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := gcpKeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
+	reader, err := s.client.Bucket(s.Bucket).Object(key).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, ErrBlobNotFound
+		}
+
+		s.logger.Error("getting object range reader failed", slog.String("key", key), slog.Any("error", err))
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+func (s *GCPBlobStore) PutReader(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	if err := gcpKeyLimit.validate(key); err != nil {
+		return err
+	}
+
+	obj, err := s.conditionalObject(ctx, key, opts.IfMatch, opts.IfNoneMatch)
+	if err != nil {
+		return err
+	}
+
+	// cancelling the context aborts the upload; closing the writer would commit
+	// whatever was written so far
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	writer := obj.NewWriter(ctx)
+	writer.ContentType = opts.ContentType
+
+	// small uploads go in a single request, larger ones as a resumable upload
+	// in chunks of PartSize; abandoned resumable sessions expire after a week
+	config := s.Multipart.withDefaults()
+	if config.useMultipart(size) {
+		writer.ChunkSize = int(config.PartSize)
+	} else {
+		writer.ChunkSize = 0
+	}
+
+	if _, err := io.Copy(writer, r); err != nil {
+		cancel()
+		writer.Close()
+		s.logger.Error("PutReader failed", slog.String("key", key), slog.Any("error", err))
+		return err
+	}
+
+	// the upload is only committed once the writer is closed
+	if err := writer.Close(); err != nil {
+		if isGCPPreconditionFailed(err) {
+			return ErrPreconditionFailed
+		}
+
+		s.logger.Error("PutReader failed to finalize upload", slog.String("key", key), slog.Any("error", err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *GCPBlobStore) Copy(ctx context.Context, src, dst string) error {
+	for _, key := range []string{src, dst} {
+		if err := gcpKeyLimit.validate(key); err != nil {
+			return err
+		}
+	}
+
+	bucket := s.client.Bucket(s.Bucket)
+	if _, err := bucket.Object(dst).CopierFrom(bucket.Object(src)).Run(ctx); err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return ErrBlobNotFound
+		}
+
+		s.logger.Error("Copy failed", slog.String("src", src), slog.String("dst", dst), slog.Any("error", err))
+		return err
+	}
+
+	return nil
+}
+
 func (s *GCPBlobStore) Delete(ctx context.Context, key string) error {
+	return s.DeleteWithOptions(ctx, key, DeleteOptions{})
+}
+
+func (s *GCPBlobStore) DeleteWithOptions(ctx context.Context, key string, opts DeleteOptions) error {
+	if err := gcpKeyLimit.validate(key); err != nil {
+		return err
+	}
+
 	defer ctx.Done()
 
-	bucket := s.client.Bucket(s.Bucket)
-	obj := bucket.Object(key)
-	if _, err := obj.Attrs(ctx); err != nil {
-		s.logger.Error("object does not exist", slog.String("key", key), slog.Any("error", err))
-		return ErrBlobNotFound
+	obj := s.client.Bucket(s.Bucket).Object(key)
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			if opts.IfMatch != "" {
+				return ErrPreconditionFailed
+			}
+			return ErrBlobNotFound
+		}
+
+		s.logger.Error("reading object attributes failed", slog.String("key", key), slog.Any("error", err))
+		return fmt.Errorf("reading attributes of %q: %w", key, err)
+	}
+
+	if opts.IfMatch != "" {
+		if err := checkPreconditions(gcpBlobInfo(attrs), nil, opts.IfMatch, false); err != nil {
+			return err
+		}
+
+		// pin the generation that matched, so a concurrent write fails the delete
+		obj = obj.If(storage.Conditions{GenerationMatch: attrs.Generation})
 	}
 
 	if err := obj.Delete(ctx); err != nil {
+		if isGCPPreconditionFailed(err) {
+			return ErrPreconditionFailed
+		}
+
 		s.logger.Error("Delete failed", slog.String("key", key), slog.Any("error", err))
 		return err
 	}
@@ -186,3 +355,127 @@ func (s *GCPBlobStore) List(ctx context.Context, prefix string) ([]string, error
 
 	return keys, nil
 }
+
+func gcpBlobInfo(attrs *storage.ObjectAttrs) BlobInfo {
+	return BlobInfo{
+		Key:          attrs.Name,
+		Size:         attrs.Size,
+		ETag:         normalizeETag(attrs.Etag),
+		ContentType:  attrs.ContentType,
+		LastModified: attrs.Updated,
+		Metadata:     attrs.Metadata,
+	}
+}
+
+func (s *GCPBlobStore) ListPage(ctx context.Context, opts ListOptions) (ListResult, error) {
+	query := &storage.Query{Prefix: opts.Prefix, Delimiter: opts.Delimiter}
+	it := s.client.Bucket(s.Bucket).Objects(ctx, query)
+
+	var attrs []*storage.ObjectAttrs
+	nextToken, err := iterator.NewPager(it, opts.limit(), opts.Cursor).NextPage(&attrs)
+	if err != nil {
+		if opts.Cursor != "" && isGCPBadRequest(err) {
+			return ListResult{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+		}
+
+		s.logger.Error("ListPage failed", slog.String("prefix", opts.Prefix), slog.Any("error", err))
+		return ListResult{}, err
+	}
+
+	result := ListResult{NextCursor: nextToken}
+	for _, attr := range attrs {
+		// with a delimiter, common prefixes come back as entries without a name
+		if attr.Name == "" && attr.Prefix != "" {
+			result.Prefixes = append(result.Prefixes, attr.Prefix)
+			continue
+		}
+
+		result.Items = append(result.Items, gcpBlobInfo(attr))
+	}
+
+	return result, nil
+}
+
+func (s *GCPBlobStore) DeleteMany(ctx context.Context, keys []string) ([]DeleteResult, error) {
+	if len(keys) > MaxDeleteBatch {
+		return nil, ErrTooManyKeys
+	}
+
+	bucket := s.client.Bucket(s.Bucket)
+	return deleteConcurrently(ctx, keys, gcpKeyLimit.validate, func(ctx context.Context, key string) error {
+		if err := bucket.Object(key).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return err
+		}
+		return nil
+	}), nil
+}
+
+// conditionalObject returns a handle for key that carries the write preconditions.
+// GCS preconditions work on generations, so an IfMatch ETag is resolved to the
+// generation it belongs to.
+func (s *GCPBlobStore) conditionalObject(ctx context.Context, key, ifMatch string, ifNoneMatch bool) (*storage.ObjectHandle, error) {
+	obj := s.client.Bucket(s.Bucket).Object(key)
+	if ifMatch == "" {
+		if ifNoneMatch {
+			obj = obj.If(storage.Conditions{DoesNotExist: true})
+		}
+		return obj, nil
+	}
+
+	attrs, err := obj.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrPreconditionFailed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPreconditions(gcpBlobInfo(attrs), nil, ifMatch, ifNoneMatch); err != nil {
+		return nil, err
+	}
+
+	return obj.If(storage.Conditions{GenerationMatch: attrs.Generation}), nil
+}
+
+// isGCPPreconditionFailed reports whether a generation precondition was not met.
+func isGCPPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == 412
+}
+
+// isGCPBadRequest reports whether a request parameter, like a page token, was rejected.
+func isGCPBadRequest(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == 400
+}
+
+// Presign returns a V4 signed URL; this needs service account credentials.
+func (s *GCPBlobStore) Presign(ctx context.Context, key string, opts PresignOptions) (PresignedRequest, error) {
+	if err := gcpKeyLimit.validate(key); err != nil {
+		return PresignedRequest{}, err
+	}
+
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	expiresAt := time.Now().Add(opts.TTL)
+	signedURL, err := s.client.Bucket(s.Bucket).SignedURL(key, &storage.SignedURLOptions{
+		Scheme:      storage.SigningSchemeV4,
+		Method:      opts.Method,
+		Expires:     expiresAt,
+		ContentType: opts.contentTypeHeader()["Content-Type"],
+	})
+	if err != nil {
+		s.logger.Error("SignedURL failed", slog.String("key", key), slog.String("method", opts.Method), slog.Any("error", err))
+		return PresignedRequest{}, err
+	}
+
+	return PresignedRequest{
+		URL:       signedURL,
+		Method:    opts.Method,
+		Headers:   opts.contentTypeHeader(),
+		ExpiresAt: expiresAt,
+	}, nil
+}
@@ -0,0 +1,107 @@
+package blobstore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timgluz/blobber/pkg/blobstore"
+	"google.golang.org/api/option"
+)
+
+// fakeGCSUploads answers GCS simple and resumable uploads and records the
+// objects that were finalized.
+type fakeGCSUploads struct {
+	mu      sync.Mutex
+	objects []string
+}
+
+func (f *fakeGCSUploads) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		// the client aborted the request
+		return
+	}
+
+	switch {
+	case r.URL.Query().Get("uploadType") == "resumable":
+		w.Header().Set("Location", "http://"+r.Host+"/upload/session/1")
+		w.WriteHeader(http.StatusOK)
+		return
+	case r.URL.Path == "/upload/session/1" && strings.Contains(r.Header.Get("Content-Range"), "/*"):
+		// an intermediate chunk of unknown total size
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(body)-1))
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+
+	f.mu.Lock()
+	f.objects = append(f.objects, r.URL.Path)
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"bucket": "test", "name": "broken.bin"}`)
+}
+
+func (f *fakeGCSUploads) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.objects)
+}
+
+// failingReader returns n bytes and then fails, like a dropped client connection.
+type failingReader struct {
+	n int
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, errors.New("connection reset")
+	}
+
+	n := min(len(p), r.n)
+	for i := range p[:n] {
+		p[i] = 'x'
+	}
+	r.n -= n
+	return n, nil
+}
+
+func TestGCPBlobStore_PutReaderAbortsFailedUploads(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64
+	}{
+		{name: "single request", size: 1 << 20},
+		{name: "resumable upload", size: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGCSUploads{}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			client, err := storage.NewClient(context.Background(),
+				option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+			require.NoError(t, err)
+			defer client.Close()
+
+			store, err := blobstore.NewGCPBlobStore("test", client, initTestLogger(t))
+			require.NoError(t, err)
+
+			err = store.PutReader(context.Background(), "broken.bin", &failingReader{n: 512 << 10}, tt.size, blobstore.PutOptions{})
+			require.Error(t, err)
+			assert.Zero(t, fake.count(), "no object may be committed")
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package blobstore
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxKeyLength is the longest key in bytes accepted by any of the providers.
+const MaxKeyLength = 1024
+
+// keyLimit describes the longest key a provider accepts.
+type keyLimit struct {
+	max        int
+	countRunes bool // the limit is in characters instead of UTF-8 bytes
+}
+
+var (
+	s3KeyLimit       = keyLimit{max: 1024}
+	gcpKeyLimit      = keyLimit{max: 1024}
+	azureKeyLimit    = keyLimit{max: 1024, countRunes: true}
+	alicloudKeyLimit = keyLimit{max: 1023}
+)
+
+// validate checks the key with ValidateKey and enforces the provider length limit.
+func (l keyLimit) validate(key string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	length := len(key)
+	if l.countRunes {
+		length = utf8.RuneCountInString(key)
+	}
+
+	if length > l.max {
+		return fmt.Errorf("%w: key is longer than %d characters", ErrInvalidKey, l.max)
+	}
+
+	return nil
+}
+
+// NormalizeKey strips leading slashes and collapses empty path segments, so
+// "/users//42/avatar.png" becomes "users/42/avatar.png".
+func NormalizeKey(key string) string {
+	key = strings.TrimLeft(key, "/")
+	for strings.Contains(key, "//") {
+		key = strings.ReplaceAll(key, "//", "/")
+	}
+
+	return key
+}
+
+// ValidateKey rejects keys that are empty, not valid UTF-8, contain control
+// characters, empty, "." or ".." path segments, or are longer than MaxKeyLength.
+// Keys are expected to be normalized with NormalizeKey first.
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: key is empty", ErrInvalidKey)
+	}
+
+	if len(key) > MaxKeyLength {
+		return fmt.Errorf("%w: key is longer than %d bytes", ErrInvalidKey, MaxKeyLength)
+	}
+
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("%w: key is not valid UTF-8", ErrInvalidKey)
+	}
+
+	if strings.ContainsFunc(key, unicode.IsControl) {
+		return fmt.Errorf("%w: key contains control characters", ErrInvalidKey)
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		switch segment {
+		case "":
+			return fmt.Errorf("%w: key contains an empty path segment", ErrInvalidKey)
+		case ".", "..":
+			return fmt.Errorf("%w: key contains a relative path segment", ErrInvalidKey)
+		}
+	}
+
+	return nil
+}
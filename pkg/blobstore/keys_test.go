@@ -0,0 +1,54 @@
+package blobstore_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timgluz/blobber/pkg/blobstore"
+)
+
+func TestNormalizeKey(t *testing.T) {
+	tests := map[string]string{
+		"test.json":             "test.json",
+		"/users/42/avatar.png":  "users/42/avatar.png",
+		"users//42///avatar":    "users/42/avatar",
+		"//leading/and/middle/": "leading/and/middle/",
+	}
+
+	for input, expected := range tests {
+		assert.Equal(t, expected, blobstore.NormalizeKey(input), "input %q", input)
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	valid := []string{
+		"test.json",
+		"users/42/avatar.png",
+		"reports/2026/Q1 summary (final).pdf",
+		"ünïcödé/ключ.txt",
+		"..hidden/file..txt",
+	}
+	for _, key := range valid {
+		assert.NoError(t, blobstore.ValidateKey(key), "key %q should be valid", key)
+	}
+
+	invalid := []string{
+		"",
+		"users//42",
+		"/absolute",
+		"trailing/",
+		"../escape",
+		"users/../admin",
+		"./current",
+		"tab\there",
+		"newline\n",
+		"nul\x00byte",
+		"del\x7f",
+		"invalid-\xff-utf8",
+		strings.Repeat("a", blobstore.MaxKeyLength+1),
+	}
+	for _, key := range invalid {
+		assert.ErrorIs(t, blobstore.ValidateKey(key), blobstore.ErrInvalidKey, "key %q should be invalid", key)
+	}
+}
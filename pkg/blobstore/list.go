@@ -0,0 +1,136 @@
+package blobstore
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultListLimit is the page size used when ListOptions.Limit is zero.
+	DefaultListLimit = 1000
+	// MaxListLimit is the largest page size all providers support.
+	MaxListLimit = 1000
+)
+
+// ListOptions selects one page of blobs.
+type ListOptions struct {
+	Prefix string
+	// Delimiter groups keys sharing the part of the key up to the next delimiter
+	// after the prefix into a single entry of ListResult.Prefixes, like folders.
+	Delimiter string
+	// Limit is the maximum number of entries in the page, capped at MaxListLimit.
+	Limit int
+	// Cursor continues a previous listing. It is opaque and provider specific.
+	Cursor string
+	// Details asks for the size, ETag and modification time of every item.
+	// Providers returning them with the listing always fill them in; the others
+	// only look them up when it is set.
+	Details bool
+}
+
+// ListResult is a single page of blobs.
+type ListResult struct {
+	// Items carry the attributes the provider returns in its listing, which
+	// may not include the content type and user metadata.
+	Items []BlobInfo
+	// Prefixes holds the common prefixes when listing with a delimiter.
+	Prefixes []string
+	// NextCursor fetches the following page; it is empty when the listing is complete.
+	NextCursor string
+}
+
+// Keys returns the keys of the listed blobs.
+func (r ListResult) Keys() []string {
+	keys := make([]string, len(r.Items))
+	for i, item := range r.Items {
+		keys[i] = item.Key
+	}
+
+	return keys
+}
+
+func (o ListOptions) limit() int {
+	if o.Limit <= 0 || o.Limit > MaxListLimit {
+		return DefaultListLimit
+	}
+
+	return o.Limit
+}
+
+// pageSortedKeys slices one page out of a complete, sorted key listing. It backs
+// the stores that have no native pagination; their cursor is the last entry returned.
+// The returned items only carry keys.
+func pageSortedKeys(keys []string, opts ListOptions) (ListResult, error) {
+	entries, prefixes := keys, map[string]bool{}
+	if opts.Delimiter != "" {
+		entries, prefixes = groupByDelimiter(keys, opts.Prefix, opts.Delimiter)
+	}
+
+	start := 0
+	if opts.Cursor != "" {
+		after, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		if err != nil {
+			return ListResult{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+		}
+
+		start = sort.SearchStrings(entries, string(after))
+		if start < len(entries) && entries[start] == string(after) {
+			start++
+		}
+	}
+
+	end := min(start+opts.limit(), len(entries))
+
+	var result ListResult
+	for _, entry := range entries[start:end] {
+		if prefixes[entry] {
+			result.Prefixes = append(result.Prefixes, entry)
+		} else {
+			result.Items = append(result.Items, BlobInfo{Key: entry})
+		}
+	}
+
+	if end < len(entries) {
+		result.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(entries[end-1]))
+	}
+
+	return result, nil
+}
+
+// groupByDelimiter collapses sorted keys that share a common prefix into a single
+// entry. Keys under a common prefix are contiguous in sorted order and sort after
+// the prefix itself, so the returned entries stay sorted.
+func groupByDelimiter(keys []string, prefix, delimiter string) ([]string, map[string]bool) {
+	entries := make([]string, 0, len(keys))
+	prefixes := make(map[string]bool)
+
+	for _, key := range keys {
+		rest := strings.TrimPrefix(key, prefix)
+		idx := strings.Index(rest, delimiter)
+		if idx < 0 {
+			entries = append(entries, key)
+			continue
+		}
+
+		commonPrefix := prefix + rest[:idx+len(delimiter)]
+		if !prefixes[commonPrefix] {
+			prefixes[commonPrefix] = true
+			entries = append(entries, commonPrefix)
+		}
+	}
+
+	return entries, prefixes
+}
+
+// statItems fills in the attributes of key-only list items. Blobs deleted since
+// they were listed keep their key-only entry.
+func statItems(ctx context.Context, store BlobStore, items []BlobInfo) {
+	for i, item := range items {
+		if info, err := store.Stat(ctx, item.Key); err == nil {
+			items[i] = info
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package blobstore
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryConfig limits the size of the in-memory store; zero values mean unlimited.
+// When a limit is hit, the least recently used blobs are evicted.
+type MemoryConfig struct {
+	MaxBytes int64 `yaml:"max_bytes"`
+	MaxItems int   `yaml:"max_items"`
+}
+
+type memoryItem struct {
+	key         string
+	data        []byte
+	etag        string
+	contentType string
+	modTime     time.Time
+}
+
+type MemoryBlobStore struct {
+	Config MemoryConfig
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List // front is the most recently used item
+	size  int64
+
+	logger *slog.Logger
+}
+
+func NewMemoryBlobStore(config MemoryConfig, logger *slog.Logger) (*MemoryBlobStore, error) {
+	if logger == nil {
+		return nil, ErrNoValidLogger
+	}
+
+	return &MemoryBlobStore{
+		Config: config,
+		items:  make(map[string]*list.Element),
+		lru:    list.New(),
+		logger: logger,
+	}, nil
+}
+
+func (s *MemoryBlobStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryBlobStore) List(ctx context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for key := range s.items {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *MemoryBlobStore) ListPage(ctx context.Context, opts ListOptions) (ListResult, error) {
+	keys, err := s.List(ctx, opts.Prefix)
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	result, err := pageSortedKeys(keys, opts)
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	if opts.Details {
+		statItems(ctx, s, result.Items)
+	}
+	return result, nil
+}
+
+func (s *MemoryBlobStore) Has(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[key]; !ok {
+		return ErrBlobNotFound
+	}
+
+	return nil
+}
+
+func (s *MemoryBlobStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.statLocked(key)
+}
+
+// statLocked returns the attributes of a blob; the caller must hold s.mu.
+func (s *MemoryBlobStore) statLocked(key string) (BlobInfo, error) {
+	elem, ok := s.items[key]
+	if !ok {
+		return BlobInfo{}, ErrBlobNotFound
+	}
+
+	item := elem.Value.(*memoryItem)
+	return BlobInfo{
+		Key:          item.key,
+		Size:         int64(len(item.data)),
+		ETag:         item.etag,
+		ContentType:  item.contentType,
+		LastModified: item.modTime,
+	}, nil
+}
+
+func (s *MemoryBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+
+	s.lru.MoveToFront(elem)
+	item := elem.Value.(*memoryItem)
+
+	return bytes.Clone(item.data), nil
+}
+
+func (s *MemoryBlobStore) Put(ctx context.Context, key string, data []byte) error {
+	return s.put(key, data, PutOptions{})
+}
+
+func (s *MemoryBlobStore) put(key string, data []byte, opts PutOptions) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	if s.Config.MaxBytes > 0 && int64(len(data)) > s.Config.MaxBytes {
+		return ErrBlobTooLarge
+	}
+
+	checksum := md5.Sum(data)
+	item := &memoryItem{
+		key:         key,
+		data:        bytes.Clone(data),
+		etag:        hex.EncodeToString(checksum[:]),
+		contentType: opts.ContentType,
+		modTime:     time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.statLocked(key)
+	if err := checkPreconditions(current, err, opts.IfMatch, opts.IfNoneMatch); err != nil {
+		return err
+	}
+
+	if elem, ok := s.items[key]; ok {
+		s.removeElement(elem)
+	}
+
+	s.items[key] = s.lru.PushFront(item)
+	s.size += int64(len(item.data))
+
+	s.evict()
+	return nil
+}
+
+func (s *MemoryBlobStore) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	data, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MemoryBlobStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	data, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	offset = min(max(offset, 0), int64(len(data)))
+	end := int64(len(data))
+	if length >= 0 {
+		end = min(offset+length, end)
+	}
+
+	return io.NopCloser(bytes.NewReader(data[offset:end])), nil
+}
+
+// PutReader buffers the content, as the store keeps every blob in memory anyway.
+func (s *MemoryBlobStore) PutReader(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	if s.Config.MaxBytes > 0 {
+		r = io.LimitReader(r, s.Config.MaxBytes+1)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return s.put(key, data, opts)
+}
+
+func (s *MemoryBlobStore) DeleteMany(ctx context.Context, keys []string) ([]DeleteResult, error) {
+	if len(keys) > MaxDeleteBatch {
+		return nil, ErrTooManyKeys
+	}
+
+	return deleteConcurrently(ctx, keys, ValidateKey, s.Delete), nil
+}
+
+func (s *MemoryBlobStore) Copy(ctx context.Context, src, dst string) error {
+	if err := ValidateKey(dst); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[src]
+	if !ok {
+		return ErrBlobNotFound
+	}
+
+	// blob data is never modified in place, so the copy can share it
+	copied := *elem.Value.(*memoryItem)
+	copied.key = dst
+	copied.modTime = time.Now().UTC()
+
+	if elem, ok := s.items[dst]; ok {
+		s.removeElement(elem)
+	}
+
+	s.items[dst] = s.lru.PushFront(&copied)
+	s.size += int64(len(copied.data))
+
+	s.evict()
+	return nil
+}
+
+func (s *MemoryBlobStore) Delete(ctx context.Context, key string) error {
+	return s.DeleteWithOptions(ctx, key, DeleteOptions{})
+}
+
+func (s *MemoryBlobStore) DeleteWithOptions(ctx context.Context, key string, opts DeleteOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		if opts.IfMatch != "" {
+			return ErrPreconditionFailed
+		}
+		return ErrBlobNotFound
+	}
+
+	if opts.IfMatch != "" && elem.Value.(*memoryItem).etag != normalizeETag(opts.IfMatch) {
+		return ErrPreconditionFailed
+	}
+
+	s.removeElement(elem)
+	return nil
+}
+
+// evict drops least recently used items until the store is within its limits.
+// Callers must hold the lock.
+func (s *MemoryBlobStore) evict() {
+	for s.overLimit() {
+		elem := s.lru.Back()
+		if elem == nil {
+			return
+		}
+
+		item := elem.Value.(*memoryItem)
+		s.logger.Debug("Evicting blob", slog.String("key", item.key), slog.Int("size", len(item.data)))
+		s.removeElement(elem)
+	}
+}
+
+func (s *MemoryBlobStore) overLimit() bool {
+	if s.Config.MaxItems > 0 && s.lru.Len() > s.Config.MaxItems {
+		return true
+	}
+
+	return s.Config.MaxBytes > 0 && s.size > s.Config.MaxBytes
+}
+
+func (s *MemoryBlobStore) removeElement(elem *list.Element) {
+	item := s.lru.Remove(elem).(*memoryItem)
+	delete(s.items, item.key)
+	s.size -= int64(len(item.data))
+}
@@ -0,0 +1,191 @@
+package blobstore_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timgluz/blobber/pkg/blobstore"
+)
+
+func TestMemoryBlobStore_CRUD(t *testing.T) {
+	store := newTestMemoryStore(t, blobstore.MemoryConfig{})
+	ctx := context.Background()
+
+	testKey := "put_test.json"
+	testData := []byte(`{"put": "test"}`)
+
+	require.NoError(t, store.Put(ctx, testKey, testData))
+	require.NoError(t, store.Has(ctx, testKey))
+
+	info, err := store.Stat(ctx, testKey)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(testData)), info.Size)
+	assert.Equal(t, "bbe3ea2db6dfb062df0e306a43575199", info.ETag)
+
+	retrievedData, err := store.Get(ctx, testKey)
+	require.NoError(t, err)
+	assert.Equal(t, testData, retrievedData)
+
+	keys, err := store.List(ctx, "put")
+	require.NoError(t, err)
+	assert.Equal(t, []string{testKey}, keys)
+
+	require.NoError(t, store.Delete(ctx, testKey))
+	assert.ErrorIs(t, store.Has(ctx, testKey), blobstore.ErrBlobNotFound)
+	assert.ErrorIs(t, store.Delete(ctx, testKey), blobstore.ErrBlobNotFound)
+
+	_, err = store.Get(ctx, testKey)
+	assert.ErrorIs(t, err, blobstore.ErrBlobNotFound)
+}
+
+func TestMemoryBlobStore_ConditionalWrites(t *testing.T) {
+	store := newTestMemoryStore(t, blobstore.MemoryConfig{})
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, "state.json", []byte("v1")))
+	info, err := store.Stat(ctx, "state.json")
+	require.NoError(t, err)
+
+	err = store.PutReader(ctx, "state.json", strings.NewReader("v2"), -1, blobstore.PutOptions{IfNoneMatch: true})
+	assert.ErrorIs(t, err, blobstore.ErrPreconditionFailed)
+
+	require.NoError(t, store.PutReader(ctx, "state.json", strings.NewReader("v2"), -1, blobstore.PutOptions{IfMatch: info.ETag}))
+
+	err = store.PutReader(ctx, "state.json", strings.NewReader("v3"), -1, blobstore.PutOptions{IfMatch: info.ETag})
+	assert.ErrorIs(t, err, blobstore.ErrPreconditionFailed)
+
+	data, err := store.Get(ctx, "state.json")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+
+	err = store.DeleteWithOptions(ctx, "missing.json", blobstore.DeleteOptions{IfMatch: info.ETag})
+	assert.ErrorIs(t, err, blobstore.ErrPreconditionFailed)
+}
+
+func TestMemoryBlobStore_ListPage(t *testing.T) {
+	store := newTestMemoryStore(t, blobstore.MemoryConfig{})
+	ctx := context.Background()
+
+	for _, key := range []string{"a/1", "a/2", "a/3", "a/4", "a/5", "b/1"} {
+		require.NoError(t, store.Put(ctx, key, []byte(key)))
+	}
+
+	var pages [][]string
+	opts := blobstore.ListOptions{Prefix: "a/", Limit: 2}
+	for {
+		page, err := store.ListPage(ctx, opts)
+		require.NoError(t, err)
+		pages = append(pages, page.Keys())
+
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	assert.Equal(t, [][]string{{"a/1", "a/2"}, {"a/3", "a/4"}, {"a/5"}}, pages)
+
+	_, err := store.ListPage(ctx, blobstore.ListOptions{Cursor: "not base64!"})
+	assert.ErrorIs(t, err, blobstore.ErrInvalidCursor)
+}
+
+func TestMemoryBlobStore_ListPageWithDelimiter(t *testing.T) {
+	store := newTestMemoryStore(t, blobstore.MemoryConfig{})
+	ctx := context.Background()
+
+	for _, key := range []string{"users/1/a.txt", "users/1/b.txt", "users/2/c.txt", "users/readme.md", "users-old.txt"} {
+		require.NoError(t, store.Put(ctx, key, []byte(key)))
+	}
+
+	page, err := store.ListPage(ctx, blobstore.ListOptions{Prefix: "users/", Delimiter: "/"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users/1/", "users/2/"}, page.Prefixes)
+	assert.Equal(t, []string{"users/readme.md"}, page.Keys())
+	assert.Zero(t, page.Items[0].Size, "details are only looked up on request")
+
+	page, err = store.ListPage(ctx, blobstore.ListOptions{Prefix: "users/", Delimiter: "/", Details: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("users/readme.md")), page.Items[0].Size)
+
+	page, err = store.ListPage(ctx, blobstore.ListOptions{Delimiter: "/", Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users-old.txt"}, page.Keys())
+	assert.Empty(t, page.Prefixes)
+
+	page, err = store.ListPage(ctx, blobstore.ListOptions{Delimiter: "/", Limit: 1, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users/"}, page.Prefixes)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestMemoryBlobStore_EvictsLeastRecentlyUsedByCount(t *testing.T) {
+	store := newTestMemoryStore(t, blobstore.MemoryConfig{MaxItems: 2})
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, "a", []byte("a")))
+	require.NoError(t, store.Put(ctx, "b", []byte("b")))
+
+	// touch a, so b becomes the least recently used
+	_, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put(ctx, "c", []byte("c")))
+
+	keys, err := store.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, keys)
+}
+
+func TestMemoryBlobStore_EvictsLeastRecentlyUsedBySize(t *testing.T) {
+	store := newTestMemoryStore(t, blobstore.MemoryConfig{MaxBytes: 10})
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, "a", []byte("12345")))
+	require.NoError(t, store.Put(ctx, "b", []byte("12345")))
+	require.NoError(t, store.Put(ctx, "c", []byte("123")))
+
+	assert.ErrorIs(t, store.Has(ctx, "a"), blobstore.ErrBlobNotFound)
+	assert.NoError(t, store.Has(ctx, "b"))
+	assert.NoError(t, store.Has(ctx, "c"))
+
+	err := store.Put(ctx, "huge", []byte("12345678901"))
+	assert.ErrorIs(t, err, blobstore.ErrBlobTooLarge)
+}
+
+func TestMemoryBlobStore_ConcurrentAccess(t *testing.T) {
+	store := newTestMemoryStore(t, blobstore.MemoryConfig{MaxItems: 50})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := range 50 {
+				key := fmt.Sprintf("worker-%d/%d", worker, j)
+				assert.NoError(t, store.Put(ctx, key, []byte(key)))
+				store.Get(ctx, key)
+				store.List(ctx, "worker-")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	keys, err := store.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, keys, 50)
+}
+
+func newTestMemoryStore(t *testing.T, config blobstore.MemoryConfig) *blobstore.MemoryBlobStore {
+	t.Helper()
+
+	store, err := blobstore.NewMemoryBlobStore(config, initTestLogger(t))
+	require.NoError(t, err, "failed to create in-memory blob store")
+
+	return store
+}
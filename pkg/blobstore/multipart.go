@@ -0,0 +1,119 @@
+package blobstore
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMultipartThreshold    = 64 << 20
+	DefaultMultipartPartSize     = 16 << 20
+	DefaultMultipartCleanupAfter = 24 * time.Hour
+
+	// minMultipartPartSize is the smallest part S3 and OSS accept, except for the last one.
+	minMultipartPartSize = 5 << 20
+	// maxMultipartParts is the part limit of S3 and OSS.
+	maxMultipartParts = 10000
+	// multipartCleanupInterval is how often abandoned multipart uploads are looked for.
+	multipartCleanupInterval = time.Hour
+	// smallUploadSize is read before a whole part is buffered, so small uploads of
+	// unknown size are sent in a single request without allocating a part.
+	smallUploadSize = 1 << 20
+)
+
+// partBuffers recycles the buffers parts are read into.
+var partBuffers sync.Pool
+
+// MultipartConfig controls when uploads switch to the multipart or block API
+// of the provider. Zero values fall back to the defaults.
+type MultipartConfig struct {
+	// Threshold is the size in bytes above which uploads are sent in parts.
+	// Uploads of unknown size are always sent in parts once they exceed a single part.
+	Threshold int64 `yaml:"threshold"`
+	// PartSize is the size of each part in bytes; it is grown for very large
+	// uploads to stay within the part limit.
+	PartSize int64 `yaml:"part_size"`
+	// CleanupAfter is the age after which unfinished multipart uploads are aborted.
+	CleanupAfter time.Duration `yaml:"cleanup_after"`
+}
+
+// MultipartCleaner is implemented by stores that keep the parts of abandoned
+// multipart uploads until they are aborted.
+type MultipartCleaner interface {
+	// AbortStaleUploads aborts multipart uploads started more than olderThan ago
+	// and returns how many were aborted.
+	AbortStaleUploads(ctx context.Context, olderThan time.Duration) (int, error)
+}
+
+func (c MultipartConfig) withDefaults() MultipartConfig {
+	if c.Threshold <= 0 {
+		c.Threshold = DefaultMultipartThreshold
+	}
+
+	if c.PartSize <= 0 {
+		c.PartSize = DefaultMultipartPartSize
+	}
+	c.PartSize = max(c.PartSize, minMultipartPartSize)
+
+	if c.CleanupAfter <= 0 {
+		c.CleanupAfter = DefaultMultipartCleanupAfter
+	}
+
+	return c
+}
+
+// useMultipart reports whether an upload of size bytes should be sent in parts.
+func (c MultipartConfig) useMultipart(size int64) bool {
+	return size < 0 || size > c.Threshold
+}
+
+// partSizeFor returns the part size for an upload of size bytes, so it fits
+// into maxMultipartParts parts.
+func (c MultipartConfig) partSizeFor(size int64) int64 {
+	if size <= 0 {
+		return c.PartSize
+	}
+
+	return max(c.PartSize, (size+maxMultipartParts-1)/maxMultipartParts)
+}
+
+// getPartBuffer returns a buffer of size bytes; release it with putPartBuffer.
+func getPartBuffer(size int64) *[]byte {
+	if buf, ok := partBuffers.Get().(*[]byte); ok && int64(cap(*buf)) >= size {
+		*buf = (*buf)[:size]
+		return buf
+	}
+
+	buf := make([]byte, size)
+	return &buf
+}
+
+func putPartBuffer(buf *[]byte) {
+	partBuffers.Put(buf)
+}
+
+// RunMultipartCleanup periodically aborts multipart uploads older than
+// config.CleanupAfter until the context is cancelled.
+func RunMultipartCleanup(ctx context.Context, cleaner MultipartCleaner, config MultipartConfig, logger *slog.Logger) {
+	config = config.withDefaults()
+
+	ticker := time.NewTicker(multipartCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		aborted, err := cleaner.AbortStaleUploads(ctx, config.CleanupAfter)
+		if err != nil {
+			logger.Error("Aborting stale multipart uploads failed", slog.Any("error", err))
+		} else if aborted > 0 {
+			logger.Info("Aborted stale multipart uploads", slog.Int("count", aborted))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultPresignTTL = 15 * time.Minute
+	// MaxPresignTTL is the longest validity accepted by all providers.
+	MaxPresignTTL = 7 * 24 * time.Hour
+)
+
+// PresignOptions describes the request a presigned URL is valid for.
+type PresignOptions struct {
+	// Method is either http.MethodGet or http.MethodPut.
+	Method string
+	// TTL is how long the URL stays valid; zero selects DefaultPresignTTL.
+	TTL time.Duration
+	// ContentType is the type clients have to send with an upload.
+	ContentType string
+}
+
+// PresignedRequest is a URL clients can use to transfer a blob directly with the
+// provider, along with the headers they have to send.
+type PresignedRequest struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Presigner is implemented by stores whose provider can sign URLs for direct
+// uploads and downloads.
+type Presigner interface {
+	// Presign returns a URL for the request described by opts, or
+	// ErrInvalidPresignRequest when the options are not supported.
+	Presign(ctx context.Context, key string, opts PresignOptions) (PresignedRequest, error)
+}
+
+// withDefaults validates the options and fills in the default TTL.
+func (o PresignOptions) withDefaults() (PresignOptions, error) {
+	if o.Method != http.MethodGet && o.Method != http.MethodPut {
+		return o, fmt.Errorf("%w: method must be GET or PUT", ErrInvalidPresignRequest)
+	}
+
+	if o.TTL == 0 {
+		o.TTL = DefaultPresignTTL
+	}
+
+	if o.TTL < 0 || o.TTL > MaxPresignTTL {
+		return o, fmt.Errorf("%w: ttl must be between 1s and %s", ErrInvalidPresignRequest, MaxPresignTTL)
+	}
+
+	return o, nil
+}
+
+// contentTypeHeader returns the headers a client has to send with a presigned upload.
+func (o PresignOptions) contentTypeHeader() map[string]string {
+	if o.Method != http.MethodPut || o.ContentType == "" {
+		return nil
+	}
+
+	return map[string]string{"Content-Type": o.ContentType}
+}
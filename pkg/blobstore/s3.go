@@ -3,12 +3,22 @@ package blobstore
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 func NewS3Client(config S3Config, credsProvider aws.CredentialsProvider, logger *slog.Logger) (*s3.Client, error) {
@@ -39,7 +49,9 @@ func NewS3Client(config S3Config, credsProvider aws.CredentialsProvider, logger
 }
 
 type S3BlobStore struct {
-	Bucket string
+	Bucket    string
+	Multipart MultipartConfig
+
 	client *s3.Client
 	logger *slog.Logger
 }
@@ -59,7 +71,7 @@ func NewS3BlobStore(bucket string, client *s3.Client, logger *slog.Logger) (*S3B
 		}))
 	}
 
-	return &S3BlobStore{bucket, client, logger}, nil
+	return &S3BlobStore{Bucket: bucket, client: client, logger: logger}, nil
 }
 
 func (s *S3BlobStore) Ping(ctx context.Context) error {
@@ -77,6 +89,10 @@ func (s *S3BlobStore) Ping(ctx context.Context) error {
 }
 
 func (s *S3BlobStore) Has(ctx context.Context, key string) error {
+	if err := s3KeyLimit.validate(key); err != nil {
+		return err
+	}
+
 	s.logger.Debug("Has", slog.String("key", key))
 
 	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
@@ -85,15 +101,55 @@ func (s *S3BlobStore) Has(ctx context.Context, key string) error {
 	})
 
 	if err != nil {
+		if isS3NotFound(err) {
+			return ErrBlobNotFound
+		}
+
 		s.logger.Error("HeadObject failed", slog.String("key", key),
 			slog.String("bucket", s.Bucket), slog.Any("error", err))
-		return ErrBlobNotFound
+		return err
 	}
 
 	return nil
 }
 
+func (s *S3BlobStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	if err := s3KeyLimit.validate(key); err != nil {
+		return BlobInfo{}, err
+	}
+
+	s.logger.Debug("Stat", slog.String("key", key))
+
+	response, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		if isS3NotFound(err) {
+			return BlobInfo{}, ErrBlobNotFound
+		}
+
+		s.logger.Error("HeadObject failed", slog.String("key", key),
+			slog.String("bucket", s.Bucket), slog.Any("error", err))
+		return BlobInfo{}, err
+	}
+
+	return BlobInfo{
+		Key:          key,
+		Size:         aws.ToInt64(response.ContentLength),
+		ETag:         normalizeETag(aws.ToString(response.ETag)),
+		ContentType:  aws.ToString(response.ContentType),
+		LastModified: aws.ToTime(response.LastModified),
+		Metadata:     response.Metadata,
+	}, nil
+}
+
 func (s *S3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := s3KeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
 	s.logger.Debug("Get", slog.String("key", key))
 
 	response, err := s.client.GetObject(ctx, &s3.GetObjectInput{
@@ -119,6 +175,10 @@ func (s *S3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
 }
 
 func (s *S3BlobStore) Put(ctx context.Context, key string, data []byte) error {
+	if err := s3KeyLimit.validate(key); err != nil {
+		return err
+	}
+
 	s.logger.Debug("Put", slog.String("key", key), slog.Int("size", len(data)))
 
 	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
@@ -135,26 +195,372 @@ func (s *S3BlobStore) Put(ctx context.Context, key string, data []byte) error {
 	return nil
 }
 
-func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
-	s.logger.Debug("Delete", slog.String("key", key))
+func (s *S3BlobStore) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := s3KeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("GetReader", slog.String("key", key))
+
+	response, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrBlobNotFound
+		}
+
+		s.logger.Error("GetObject failed", slog.String("key", key),
+			slog.String("bucket", s.Bucket), slog.Any("error", err))
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+func (s *S3BlobStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := s3KeyLimit.validate(key); err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("GetRange", slog.String("key", key), slog.Int64("offset", offset), slog.Int64("length", length))
+
+	response, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(httpRange(offset, length)),
+	})
+
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrBlobNotFound
+		}
+
+		s.logger.Error("GetObject failed", slog.String("key", key),
+			slog.String("bucket", s.Bucket), slog.Any("error", err))
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+// PutReader sends uploads above the multipart threshold, or of unknown size,
+// in parts, so only a single part is buffered in memory at a time.
+func (s *S3BlobStore) PutReader(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	if err := s3KeyLimit.validate(key); err != nil {
+		return err
+	}
+
+	s.logger.Debug("PutReader", slog.String("key", key), slog.Int64("size", size))
+
+	config := s.Multipart.withDefaults()
+	if config.useMultipart(size) {
+		return s.putMultipart(ctx, key, r, size, opts, config)
+	}
+
+	return s.putObject(ctx, key, r, size, opts)
+}
+
+func (s *S3BlobStore) putObject(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(s.Bucket),
+		Key:           aws.String(key),
+		Body:          r,
+		ContentLength: aws.Int64(size),
+	}
+
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+
+	if opts.IfMatch != "" {
+		input.IfMatch = aws.String(strconv.Quote(opts.IfMatch))
+	}
 
-	if err := s.Has(ctx, key); err != nil {
-		s.logger.Error("Delete failed - object does not exist", slog.String("key", key), slog.String("bucket", s.Bucket), slog.Any("error", err))
+	if opts.IfNoneMatch {
+		input.IfNoneMatch = aws.String("*")
+	}
+
+	_, err := s.client.PutObject(ctx, input)
+
+	if err != nil {
+		if isS3WriteRejected(err, opts) {
+			return ErrPreconditionFailed
+		}
+
+		s.logger.Error("PutObject failed", slog.String("key", key), slog.String("bucket", s.Bucket), slog.Any("error", err))
+		return err
+	}
+
+	return nil
+}
+
+// putMultipart uploads r part by part and aborts the upload on failure.
+// Content that fits into the first part is sent with a single PutObject instead.
+func (s *S3BlobStore) putMultipart(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions, config MultipartConfig) error {
+	partSize := config.partSizeFor(size)
+
+	head := make([]byte, min(partSize, smallUploadSize))
+	n, err := io.ReadFull(r, head)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return s.putObject(ctx, key, bytes.NewReader(head[:n]), int64(n), opts)
+	}
+	if err != nil {
 		return err
 	}
 
-	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+	pooled := getPartBuffer(partSize)
+	defer putPartBuffer(pooled)
+	buf := *pooled
+
+	copy(buf, head)
+	rest, err := io.ReadFull(r, buf[n:])
+	n += rest
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return s.putObject(ctx, key, bytes.NewReader(buf[:n]), int64(n), opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	createInput := &s3.CreateMultipartUploadInput{
 		Bucket: aws.String(s.Bucket),
 		Key:    aws.String(key),
+	}
+	if opts.ContentType != "" {
+		createInput.ContentType = aws.String(opts.ContentType)
+	}
+
+	upload, err := s.client.CreateMultipartUpload(ctx, createInput)
+	if err != nil {
+		s.logger.Error("CreateMultipartUpload failed", slog.String("key", key), slog.String("bucket", s.Bucket), slog.Any("error", err))
+		return err
+	}
+
+	if err := s.uploadParts(ctx, key, upload.UploadId, r, buf, n, opts); err != nil {
+		// the upload may be cancelled already, but its parts still have to go
+		_, abortErr := s.client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.Bucket),
+			Key:      aws.String(key),
+			UploadId: upload.UploadId,
+		})
+		if abortErr != nil {
+			s.logger.Warn("AbortMultipartUpload failed", slog.String("key", key), slog.Any("error", abortErr))
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// uploadParts sends the first n bytes of buf followed by the rest of r as
+// parts and completes the upload.
+func (s *S3BlobStore) uploadParts(ctx context.Context, key string, uploadID *string, r io.Reader, buf []byte, n int, opts PutOptions) error {
+	var parts []types.CompletedPart
+	for partNumber := int32(1); n > 0; partNumber++ {
+		if partNumber > maxMultipartParts {
+			return fmt.Errorf("%w: more than %d parts", ErrBlobTooLarge, maxMultipartParts)
+		}
+
+		part, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(s.Bucket),
+			Key:           aws.String(key),
+			UploadId:      uploadID,
+			PartNumber:    aws.Int32(partNumber),
+			Body:          bytes.NewReader(buf[:n]),
+			ContentLength: aws.Int64(int64(n)),
+		})
+		if err != nil {
+			s.logger.Error("UploadPart failed", slog.String("key", key), slog.Int("part", int(partNumber)), slog.Any("error", err))
+			return err
+		}
+		parts = append(parts, types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(partNumber)})
+
+		n, err = io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+	}
+
+	input := &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.Bucket),
+		Key:             aws.String(key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}
+
+	if opts.IfMatch != "" {
+		input.IfMatch = aws.String(strconv.Quote(opts.IfMatch))
+	}
+
+	if opts.IfNoneMatch {
+		input.IfNoneMatch = aws.String("*")
+	}
+
+	if _, err := s.client.CompleteMultipartUpload(ctx, input); err != nil {
+		if isS3WriteRejected(err, opts) {
+			return ErrPreconditionFailed
+		}
+
+		s.logger.Error("CompleteMultipartUpload failed", slog.String("key", key), slog.String("bucket", s.Bucket), slog.Any("error", err))
+		return err
+	}
+
+	return nil
+}
+
+// AbortStaleUploads aborts the multipart uploads in the bucket that were started
+// more than olderThan ago.
+func (s *S3BlobStore) AbortStaleUploads(ctx context.Context, olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan)
+
+	aborted := 0
+	paginator := s3.NewListMultipartUploadsPaginator(s.client, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s.Bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return aborted, err
+		}
+
+		for _, upload := range page.Uploads {
+			if upload.Initiated == nil || upload.Initiated.After(cutoff) {
+				continue
+			}
+
+			_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(s.Bucket),
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			})
+			if err != nil {
+				if isS3UploadNotFound(err) {
+					continue
+				}
+				return aborted, err
+			}
+
+			s.logger.Debug("Aborted stale multipart upload", slog.String("key", aws.ToString(upload.Key)))
+			aborted++
+		}
+	}
+
+	return aborted, nil
+}
+
+// Copy uses CopyObject, which is limited to objects of up to 5GB.
+func (s *S3BlobStore) Copy(ctx context.Context, src, dst string) error {
+	for _, key := range []string{src, dst} {
+		if err := s3KeyLimit.validate(key); err != nil {
+			return err
+		}
+	}
+
+	s.logger.Debug("Copy", slog.String("src", src), slog.String("dst", dst))
+
+	// the copy source is "<bucket>/<key>" and must be URL-encoded
+	segments := strings.Split(s.Bucket+"/"+src, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.Bucket),
+		Key:        aws.String(dst),
+		CopySource: aws.String(strings.Join(segments, "/")),
 	})
 
 	if err != nil {
+		if isS3NotFound(err) {
+			return ErrBlobNotFound
+		}
+
+		s.logger.Error("CopyObject failed", slog.String("src", src), slog.String("dst", dst),
+			slog.String("bucket", s.Bucket), slog.Any("error", err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	return s.DeleteWithOptions(ctx, key, DeleteOptions{})
+}
+
+// DeleteWithOptions deletes without looking the key up first, so deleting a
+// missing key succeeds like it does on S3; conditional deletes of missing keys
+// fail the precondition.
+func (s *S3BlobStore) DeleteWithOptions(ctx context.Context, key string, opts DeleteOptions) error {
+	if err := s3KeyLimit.validate(key); err != nil {
+		return err
+	}
+
+	s.logger.Debug("Delete", slog.String("key", key))
+
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	}
+
+	if opts.IfMatch != "" {
+		input.IfMatch = aws.String(strconv.Quote(opts.IfMatch))
+	}
+
+	_, err := s.client.DeleteObject(ctx, input)
+
+	if err != nil {
+		if isS3PreconditionFailed(err) || (opts.IfMatch != "" && isS3NotFound(err)) {
+			return ErrPreconditionFailed
+		}
+
 		s.logger.Error("DeleteObject failed", slog.String("key", key), slog.String("bucket", s.Bucket), slog.Any("error", err))
 		return err
 	}
 	return nil
 }
 
+func (s *S3BlobStore) DeleteMany(ctx context.Context, keys []string) ([]DeleteResult, error) {
+	if len(keys) > MaxDeleteBatch {
+		return nil, ErrTooManyKeys
+	}
+
+	results, pending := newDeleteResults(keys, s3KeyLimit.validate)
+	if len(pending) == 0 {
+		return results, nil
+	}
+
+	s.logger.Debug("DeleteMany", slog.Int("keys", len(pending)))
+
+	objects := make([]types.ObjectIdentifier, 0, len(pending))
+	indexes := make(map[string]int, len(pending))
+	for _, i := range pending {
+		objects = append(objects, types.ObjectIdentifier{Key: aws.String(keys[i])})
+		indexes[keys[i]] = i
+	}
+
+	// quiet mode only reports the keys that failed
+	response, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(s.Bucket),
+		Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+	})
+	if err != nil {
+		s.logger.Error("DeleteObjects failed", slog.String("bucket", s.Bucket), slog.Any("error", err))
+		return nil, err
+	}
+
+	for _, failure := range response.Errors {
+		if i, ok := indexes[aws.ToString(failure.Key)]; ok {
+			results[i].Err = fmt.Errorf("%s: %s", aws.ToString(failure.Code), aws.ToString(failure.Message))
+		}
+	}
+
+	return results, nil
+}
+
 func (s *S3BlobStore) List(ctx context.Context, prefix string) ([]string, error) {
 	s.logger.Debug("List", slog.String("prefix", prefix))
 
@@ -178,3 +584,147 @@ func (s *S3BlobStore) List(ctx context.Context, prefix string) ([]string, error)
 
 	return keys, nil
 }
+
+func (s *S3BlobStore) ListPage(ctx context.Context, opts ListOptions) (ListResult, error) {
+	s.logger.Debug("ListPage", slog.String("prefix", opts.Prefix), slog.Int("limit", opts.limit()))
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.Bucket),
+		Prefix:  aws.String(opts.Prefix),
+		MaxKeys: aws.Int32(int32(opts.limit())),
+	}
+
+	if opts.Cursor != "" {
+		input.ContinuationToken = aws.String(opts.Cursor)
+	}
+
+	if opts.Delimiter != "" {
+		input.Delimiter = aws.String(opts.Delimiter)
+	}
+
+	page, err := s.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		if opts.Cursor != "" && isS3InvalidArgument(err) {
+			return ListResult{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+		}
+
+		s.logger.Error("ListObjectsV2 failed", slog.String("prefix", opts.Prefix), slog.String("bucket", s.Bucket), slog.Any("error", err))
+		return ListResult{}, err
+	}
+
+	var result ListResult
+	for _, obj := range page.Contents {
+		result.Items = append(result.Items, BlobInfo{
+			Key:          aws.ToString(obj.Key),
+			Size:         aws.ToInt64(obj.Size),
+			ETag:         normalizeETag(aws.ToString(obj.ETag)),
+			LastModified: aws.ToTime(obj.LastModified),
+		})
+	}
+
+	for _, commonPrefix := range page.CommonPrefixes {
+		result.Prefixes = append(result.Prefixes, aws.ToString(commonPrefix.Prefix))
+	}
+
+	if aws.ToBool(page.IsTruncated) {
+		result.NextCursor = aws.ToString(page.NextContinuationToken)
+	}
+
+	return result, nil
+}
+
+func isS3NotFound(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.ErrorCode() {
+	case "NoSuchKey", "NotFound":
+		return true
+	default:
+		return false
+	}
+}
+
+// isS3WriteRejected reports whether a write failed one of the preconditions in opts.
+func isS3WriteRejected(err error, opts PutOptions) bool {
+	return isS3PreconditionFailed(err) || (opts.IfMatch != "" && isS3NotFound(err))
+}
+
+// isS3UploadNotFound reports whether a multipart upload was completed or aborted already.
+func isS3UploadNotFound(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchUpload"
+}
+
+// isS3InvalidArgument reports whether a request parameter, like a continuation token, was rejected.
+func isS3InvalidArgument(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidArgument"
+}
+
+// isS3PreconditionFailed reports whether a conditional write was rejected.
+func isS3PreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.ErrorCode() {
+	case "PreconditionFailed", "ConditionalRequestConflict":
+		return true
+	default:
+		return false
+	}
+}
+
+// Presign signs a GetObject or PutObject request with the credentials of the client.
+func (s *S3BlobStore) Presign(ctx context.Context, key string, opts PresignOptions) (PresignedRequest, error) {
+	if err := s3KeyLimit.validate(key); err != nil {
+		return PresignedRequest{}, err
+	}
+
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	presigner := s3.NewPresignClient(s.client, s3.WithPresignExpires(opts.TTL))
+	expiresAt := time.Now().Add(opts.TTL)
+
+	var signed *v4.PresignedHTTPRequest
+	if opts.Method == http.MethodPut {
+		input := &s3.PutObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(key)}
+		if opts.ContentType != "" {
+			input.ContentType = aws.String(opts.ContentType)
+		}
+		signed, err = presigner.PresignPutObject(ctx, input)
+	} else {
+		signed, err = presigner.PresignGetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(key)})
+	}
+
+	if err != nil {
+		s.logger.Error("Presign failed", slog.String("key", key), slog.String("method", opts.Method), slog.Any("error", err))
+		return PresignedRequest{}, err
+	}
+
+	// S3 does not sign the content type, but it is still stored with the object
+	headers := opts.contentTypeHeader()
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	for name, values := range signed.SignedHeader {
+		// the host is part of the URL already
+		if !strings.EqualFold(name, "Host") && len(values) > 0 {
+			headers[name] = values[0]
+		}
+	}
+
+	return PresignedRequest{
+		URL:       signed.URL,
+		Method:    signed.Method,
+		Headers:   headers,
+		ExpiresAt: expiresAt,
+	}, nil
+}
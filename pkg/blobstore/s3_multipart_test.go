@@ -0,0 +1,136 @@
+package blobstore_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timgluz/blobber/pkg/blobstore"
+)
+
+// fakeMultipartS3 answers the S3 calls used for uploads and records their shape.
+type fakeMultipartS3 struct {
+	mu        sync.Mutex
+	puts      int
+	partSizes []int
+	completed bool
+	aborted   bool
+	failPart  int
+}
+
+func (f *fakeMultipartS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>test</Bucket><Key>big.bin</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		if partNumber == f.failPart {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<Error><Code>InvalidRequest</Code></Error>`)
+			return
+		}
+		size, _ := strconv.Atoi(r.Header.Get("X-Amz-Decoded-Content-Length"))
+		if size == 0 {
+			size = len(body)
+		}
+		f.partSizes = append(f.partSizes, size)
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, partNumber))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.completed = true
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Key>big.bin</Key><ETag>"done"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		f.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.puts++
+		w.Header().Set("ETag", `"single"`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestS3BlobStore_PutReaderMultipart(t *testing.T) {
+	const partSize = 5 << 20
+
+	tests := []struct {
+		name      string
+		size      int
+		knownSize bool
+		failPart  int
+		wantParts []int
+		wantPuts  int
+		wantErr   bool
+	}{
+		{name: "unknown size", size: 2*partSize + 10, wantParts: []int{partSize, partSize, 10}},
+		{name: "unknown size fits into one part", size: 100, wantPuts: 1},
+		{name: "unknown size above the small upload buffer", size: 2 << 20, wantPuts: 1},
+		{name: "unknown size of exactly one part", size: partSize, wantParts: []int{partSize}},
+		{name: "known size below threshold", size: 100, knownSize: true, wantPuts: 1},
+		{name: "known size above threshold", size: partSize + 1, knownSize: true, wantParts: []int{partSize, 1}},
+		{name: "failed part aborts the upload", size: 2 * partSize, failPart: 2, wantParts: []int{partSize}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeMultipartS3{failPart: tt.failPart}
+			store := newTestFakeS3Store(t, fake)
+			store.Multipart = blobstore.MultipartConfig{Threshold: partSize, PartSize: partSize}
+
+			size := int64(-1)
+			if tt.knownSize {
+				size = int64(tt.size)
+			}
+
+			content := bytes.Repeat([]byte("x"), tt.size)
+			err := store.PutReader(context.Background(), "big.bin", bytes.NewReader(content), size, blobstore.PutOptions{})
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantParts, fake.partSizes)
+			assert.Equal(t, tt.wantPuts, fake.puts)
+			assert.Equal(t, len(tt.wantParts) > 0 && !tt.wantErr, fake.completed)
+			assert.Equal(t, tt.wantErr, fake.aborted)
+		})
+	}
+}
+
+func newTestFakeS3Store(t *testing.T, handler http.Handler) *blobstore.S3BlobStore {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	creds := aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+	})
+
+	client, err := blobstore.NewS3Client(blobstore.S3Config{
+		Endpoint:     server.URL,
+		Region:       "us-east-1",
+		UsePathStyle: true,
+	}, creds, initTestLogger(t))
+	require.NoError(t, err)
+
+	store, err := blobstore.NewS3BlobStore("test", client, initTestLogger(t))
+	require.NoError(t, err)
+
+	return store
+}
@@ -2,9 +2,13 @@ package blobstore_test
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,6 +18,7 @@ import (
 const expectedSuccessContent = `{"success": true}`
 
 func TestS3BlobStore_Get(t *testing.T) {
+	skipWithoutS3Credentials(t)
 	logger := initTestLogger(t)
 	credsProvider := blobstore.NewEnvS3Credentials()
 	s3Config := loadTestS3Config(t, "../../tests/fixtures/r2_config.yaml")
@@ -33,6 +38,7 @@ func TestS3BlobStore_Get(t *testing.T) {
 }
 
 func TestS3BlobStore_Get_NonExistentKey(t *testing.T) {
+	skipWithoutS3Credentials(t)
 	logger := initTestLogger(t)
 	credsProvider := blobstore.NewEnvS3Credentials()
 	s3Config := loadTestS3Config(t, "../../tests/fixtures/r2_config.yaml")
@@ -50,6 +56,7 @@ func TestS3BlobStore_Get_NonExistentKey(t *testing.T) {
 }
 
 func TestS3BlobStore_CRUD(t *testing.T) {
+	skipWithoutS3Credentials(t)
 	logger := initTestLogger(t)
 	credsProvider := blobstore.NewEnvS3Credentials()
 	s3Config := loadTestS3Config(t, "../../tests/fixtures/r2_config.yaml")
@@ -77,6 +84,7 @@ func TestS3BlobStore_CRUD(t *testing.T) {
 }
 
 func TestS3BlobStore_List(t *testing.T) {
+	skipWithoutS3Credentials(t)
 	logger := initTestLogger(t)
 	credsProvider := blobstore.NewEnvS3Credentials()
 	s3Config := loadTestS3Config(t, "../../tests/fixtures/r2_config.yaml")
@@ -104,6 +112,15 @@ func loadTestS3Config(t *testing.T, configPath string) *blobstore.S3Config {
 	return config
 }
 
+// skipWithoutS3Credentials skips integration tests that need a real bucket.
+func skipWithoutS3Credentials(t *testing.T) {
+	t.Helper()
+
+	if _, err := blobstore.NewEnvS3Credentials().Retrieve(context.Background()); err != nil {
+		t.Skip("S3 credentials are not configured, skipping integration test")
+	}
+}
+
 func initTestLogger(t *testing.T) *slog.Logger {
 	t.Helper()
 
@@ -113,3 +130,74 @@ func initTestLogger(t *testing.T) *slog.Logger {
 
 	return logger
 }
+
+func TestS3BlobStore_Presign(t *testing.T) {
+	store := newTestFakeS3Store(t, http.NotFoundHandler())
+	ctx := context.Background()
+
+	signed, err := store.Presign(ctx, "reports/q3.pdf", blobstore.PresignOptions{Method: http.MethodGet})
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodGet, signed.Method)
+	assert.Contains(t, signed.URL, "/test/reports/q3.pdf?")
+	assert.Contains(t, signed.URL, "X-Amz-Expires=900")
+	assert.WithinDuration(t, time.Now().Add(blobstore.DefaultPresignTTL), signed.ExpiresAt, time.Minute)
+
+	signed, err = store.Presign(ctx, "reports/q3.pdf", blobstore.PresignOptions{
+		Method: http.MethodPut, TTL: time.Hour, ContentType: "application/pdf",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPut, signed.Method)
+	assert.Contains(t, signed.URL, "X-Amz-Expires=3600")
+	assert.Equal(t, "application/pdf", signed.Headers["Content-Type"])
+
+	_, err = store.Presign(ctx, "reports/q3.pdf", blobstore.PresignOptions{Method: http.MethodDelete})
+	assert.ErrorIs(t, err, blobstore.ErrInvalidPresignRequest)
+
+	_, err = store.Presign(ctx, "reports/q3.pdf", blobstore.PresignOptions{Method: http.MethodGet, TTL: 8 * 24 * time.Hour})
+	assert.ErrorIs(t, err, blobstore.ErrInvalidPresignRequest)
+}
+
+func TestS3BlobStore_ListPageRejectsInvalidCursor(t *testing.T) {
+	store := newTestFakeS3Store(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `<Error><Code>InvalidArgument</Code><Message>The continuation token provided is incorrect</Message></Error>`)
+	}))
+
+	_, err := store.ListPage(context.Background(), blobstore.ListOptions{Cursor: "forged"})
+	assert.ErrorIs(t, err, blobstore.ErrInvalidCursor)
+
+	_, err = store.ListPage(context.Background(), blobstore.ListOptions{})
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, blobstore.ErrInvalidCursor)
+}
+
+func TestS3BlobStore_DeleteWithoutLookup(t *testing.T) {
+	var heads atomic.Int32
+	store := newTestFakeS3Store(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodHead:
+			heads.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodDelete && r.URL.Path == "/test/denied.txt":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<Error><Code>AccessDenied</Code></Error>`)
+		case r.Method == http.MethodDelete && r.Header.Get("If-Match") != "":
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `<Error><Code>PreconditionFailed</Code></Error>`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	ctx := context.Background()
+
+	// S3 deletes missing keys successfully, so no HEAD is spent on them
+	assert.NoError(t, store.Delete(ctx, "missing.txt"))
+
+	err := store.Delete(ctx, "denied.txt")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, blobstore.ErrBlobNotFound)
+
+	err = store.DeleteWithOptions(ctx, "state.json", blobstore.DeleteOptions{IfMatch: "stale"})
+	assert.ErrorIs(t, err, blobstore.ErrPreconditionFailed)
+	assert.Zero(t, heads.Load())
+}
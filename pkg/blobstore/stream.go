@@ -0,0 +1,22 @@
+package blobstore
+
+import (
+	"fmt"
+	"io"
+)
+
+// readCloser pairs a reader with the closer of the underlying resource.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// httpRange formats a byte range as a Range header value; a negative length
+// selects everything from offset to the end.
+func httpRange(offset, length int64) string {
+	if length < 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
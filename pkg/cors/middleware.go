@@ -6,7 +6,9 @@ import (
 )
 
 func CORSAllowedHeaders() string {
-	allowedHeaders := []string{"Origin", "X-Requested-With", "Content-Type", "Accept", "Authorization", "X-API-Token"}
+	allowedHeaders := []string{"Origin", "X-Requested-With", "Content-Type", "Accept", "Authorization", "X-API-Token",
+		"X-Blobber-Date", "X-Blobber-Nonce", "X-Blobber-Content-Sha256",
+		"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset"}
 
 	var b strings.Builder
 	for i, header := range allowedHeaders {
@@ -20,14 +22,21 @@ func CORSAllowedHeaders() string {
 	return b.String()
 }
 
+func CORSExposedHeaders() string {
+	return strings.Join([]string{"Accept-Ranges", "Content-Length", "Content-Range", "Content-Type", "ETag", "Last-Modified",
+		"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Metadata"}, ", ")
+}
+
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", CORSAllowedHeaders())
+		w.Header().Set("Access-Control-Expose-Headers", CORSExposedHeaders())
 		w.Header().Set("Access-Control-Max-Age", "86400") // 24 hours
 
-		if r.Method == http.MethodOptions {
+		// only answer preflights here, other OPTIONS requests like tus discovery go to the handlers
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
@@ -9,8 +9,12 @@ const ContentTypeJSON = "application/json"
 const ContentTypeOctetStream = "application/octet-stream"
 
 func RenderJSON(w http.ResponseWriter, data any) error {
+	return RenderJSONStatus(w, data, http.StatusOK)
+}
+
+func RenderJSONStatus(w http.ResponseWriter, data any, statusCode int) error {
 	w.Header().Set("Content-Type", ContentTypeJSON)
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(statusCode)
 	return json.NewEncoder(w).Encode(data)
 }
 
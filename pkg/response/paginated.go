@@ -6,24 +6,27 @@ import (
 )
 
 type Pagination struct {
-	Page       int `json:"page"`
+	Page       int `json:"page,omitempty"`
 	PageSize   int `json:"page_size"`
-	TotalItems int `json:"total_items"`
-	TotalPages int `json:"total_pages"`
+	TotalItems int `json:"total_items,omitempty"`
+	TotalPages int `json:"total_pages,omitempty"`
 }
 
 type PaginatedResponse[T any] struct {
-	Items      []T        `json:"items"`
+	Items []T `json:"items"`
+	// Prefixes lists the common prefixes ("folders") of a delimiter based listing.
+	Prefixes   []string   `json:"prefixes,omitempty"`
 	Pagination Pagination `json:"pagination"`
+	// NextCursor fetches the following page of a cursor based listing; it is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
-func RenderPaginatedJSON[T any](w http.ResponseWriter, items []T, pagination Pagination) error {
+func RenderPaginatedJSON[T any](w http.ResponseWriter, response PaginatedResponse[T]) error {
 	w.Header().Set("Content-Type", ContentTypeJSON)
 	w.WriteHeader(http.StatusOK)
 
-	response := PaginatedResponse[T]{
-		Items:      items,
-		Pagination: pagination,
+	if response.Items == nil {
+		response.Items = []T{}
 	}
 
 	return json.NewEncoder(w).Encode(response)
@@ -13,11 +13,12 @@ func NewEnvSecretStore(envVar string) *EnvSecretStore {
 	return &EnvSecretStore{envVar: envVar}
 }
 
-func (s *EnvSecretStore) ValidateToken(ctx context.Context, token string) (bool, error) {
+// ValidateToken grants the single token in the environment variable full access.
+func (s *EnvSecretStore) ValidateToken(ctx context.Context, token string) (*Principal, error) {
 	envToken := os.Getenv(s.envVar)
 	if token != envToken {
-		return false, nil
+		return nil, nil
 	}
 
-	return token == envToken, nil
+	return FullAccess(s.envVar), nil
 }
@@ -0,0 +1,261 @@
+package secret
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultReloadInterval is how often the token file is checked for changes.
+const DefaultReloadInterval = 10 * time.Second
+
+// maxVerifiedTokens bounds the cache of tokens that passed the bcrypt check.
+const maxVerifiedTokens = 1024
+
+var ErrInvalidTokenFile = errors.New("invalid token file")
+
+// TokenEntry is a single API token in the token file. Tokens have the form
+// "<name>.<secret>" and only the bcrypt hash of the secret is stored, so a
+// token is checked against a single hash.
+type TokenEntry struct {
+	Name string `yaml:"name" json:"name"`
+	Hash string `yaml:"hash" json:"hash"`
+	// ExpiresAt is optional; the token never expires when it is not set.
+	ExpiresAt time.Time `yaml:"expires_at" json:"expires_at"`
+	Disabled  bool      `yaml:"disabled" json:"disabled"`
+	// Scopes like "read:users/42/*" limit the token; without scopes it has full access.
+	Scopes []string `yaml:"scopes" json:"scopes"`
+
+	principal *Principal
+}
+
+type tokenFile struct {
+	Tokens []TokenEntry `yaml:"tokens" json:"tokens"`
+}
+
+func (e TokenEntry) active(now time.Time) bool {
+	return !e.Disabled && (e.ExpiresAt.IsZero() || now.Before(e.ExpiresAt))
+}
+
+// FileSecretStore validates tokens against the entries of a YAML or JSON file,
+// which is reloaded when it changes, so tokens can be issued and revoked
+// without a restart.
+type FileSecretStore struct {
+	path   string
+	logger *slog.Logger
+
+	mu      sync.RWMutex
+	tokens  map[string]TokenEntry
+	modTime time.Time
+	size    int64
+	// generation is bumped on every reload, so checks that raced with a reload
+	// do not cache entries of the previous file.
+	generation uint64
+	// verified caches the entries matched by a token, keyed by its SHA-256, so
+	// bcrypt only runs once per token and file version.
+	verified map[[sha256.Size]byte]TokenEntry
+}
+
+// NewFileSecretStore loads the token file; it fails when the file is missing or invalid.
+func NewFileSecretStore(path string, logger *slog.Logger) (*FileSecretStore, error) {
+	s := &FileSecretStore{path: path, logger: logger}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileSecretStore) ValidateToken(ctx context.Context, token string) (*Principal, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	name, tokenSecret, ok := splitToken(token)
+	if !ok {
+		return nil, nil
+	}
+
+	now := time.Now()
+	digest := sha256.Sum256([]byte(token))
+
+	s.mu.RLock()
+	entry, cached := s.verified[digest]
+	if !cached {
+		entry, ok = s.tokens[name]
+	}
+	generation := s.generation
+	s.mu.RUnlock()
+
+	// unknown, revoked and expired tokens are rejected before paying for bcrypt
+	if !ok || !entry.active(now) {
+		return nil, nil
+	}
+
+	if cached {
+		return entry.principal, nil
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(entry.Hash), []byte(tokenSecret)) != nil {
+		return nil, nil
+	}
+
+	s.remember(digest, entry, generation)
+	s.logger.Debug("API token accepted", slog.String("name", entry.Name))
+	return entry.principal, nil
+}
+
+// Watch reloads the token file whenever its modification time or size changes,
+// until the context is cancelled. A file that fails to load keeps the previous
+// tokens active.
+func (s *FileSecretStore) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.reloadIfChanged(); err != nil {
+				s.logger.Error("Reloading token file failed", slog.String("path", s.path), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+func (s *FileSecretStore) reloadIfChanged() error {
+	stat, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	unchanged := stat.ModTime().Equal(s.modTime) && stat.Size() == s.size
+	s.mu.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	if err := s.reload(); err != nil {
+		// remember the broken version, so it is reported once instead of on every tick
+		s.mu.Lock()
+		s.modTime, s.size = stat.ModTime(), stat.Size()
+		s.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileSecretStore) reload() error {
+	stat, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := loadTokenFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.tokens = tokens
+	s.modTime = stat.ModTime()
+	s.size = stat.Size()
+	s.generation++
+	s.verified = make(map[[sha256.Size]byte]TokenEntry)
+	s.mu.Unlock()
+
+	s.logger.Info("Loaded API tokens", slog.String("path", s.path), slog.Int("count", len(tokens)))
+	return nil
+}
+
+// remember caches a verified entry, unless the file was reloaded since it was read.
+func (s *FileSecretStore) remember(digest [sha256.Size]byte, entry TokenEntry, generation uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation {
+		return
+	}
+
+	if len(s.verified) >= maxVerifiedTokens {
+		clear(s.verified)
+	}
+	s.verified[digest] = entry
+}
+
+// splitToken splits a token into the name of its entry and its secret. Names
+// may contain dots, so the secret follows the last one.
+func splitToken(token string) (name, secret string, ok bool) {
+	i := strings.LastIndexByte(token, '.')
+	if i <= 0 || i == len(token)-1 {
+		return "", "", false
+	}
+
+	return token[:i], token[i+1:], true
+}
+
+// loadTokenFile parses a token file as JSON when it has a .json extension and
+// as YAML otherwise.
+func loadTokenFile(path string) (map[string]TokenEntry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file tokenFile
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(content, &file)
+	} else {
+		err = yaml.Unmarshal(content, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTokenFile, err)
+	}
+
+	tokens := make(map[string]TokenEntry, len(file.Tokens))
+	for i, entry := range file.Tokens {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("%w: token %d has no name", ErrInvalidTokenFile, i)
+		}
+
+		if _, ok := tokens[entry.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate token name %q", ErrInvalidTokenFile, entry.Name)
+		}
+
+		if _, err := bcrypt.Cost([]byte(entry.Hash)); err != nil {
+			return nil, fmt.Errorf("%w: token %q does not have a bcrypt hash", ErrInvalidTokenFile, entry.Name)
+		}
+
+		entry.principal = FullAccess(entry.Name)
+		if len(entry.Scopes) > 0 {
+			principal, err := NewPrincipal(entry.Name, entry.Scopes)
+			if err != nil {
+				return nil, fmt.Errorf("%w: token %q: %w", ErrInvalidTokenFile, entry.Name, err)
+			}
+			entry.principal = principal
+		}
+
+		tokens[entry.Name] = entry
+	}
+
+	return tokens, nil
+}
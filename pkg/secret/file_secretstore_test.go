@@ -0,0 +1,158 @@
+package secret_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timgluz/blobber/pkg/secret"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestFileSecretStore_ValidateToken(t *testing.T) {
+	path := writeTokenFile(t, "tokens.yaml", fmt.Sprintf(`
+tokens:
+  - name: billing
+    hash: %q
+  - name: reporting
+    hash: %q
+    expires_at: 2000-01-01T00:00:00Z
+  - name: legacy
+    hash: %q
+    disabled: true
+`, hashToken(t, "billing-token"), hashToken(t, "reporting-token"), hashToken(t, "legacy-token")))
+
+	store, err := secret.NewFileSecretStore(path, newTestLogger())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for token, want := range map[string]bool{
+		"billing.billing-token":     true,
+		"reporting.reporting-token": false,
+		"legacy.legacy-token":       false,
+		"unknown.unknown-token":     false,
+		"reporting.billing-token":   false,
+		"billing-token":             false,
+		"billing.":                  false,
+		"":                          false,
+	} {
+		principal, err := store.ValidateToken(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, want, principal != nil, token)
+	}
+
+	// the second check is answered from the cache
+	principal, err := store.ValidateToken(ctx, "billing.billing-token")
+	require.NoError(t, err)
+	require.NotNil(t, principal)
+	assert.Equal(t, "billing", principal.Name)
+	assert.True(t, principal.Allows(secret.OpDelete, "any/key"))
+}
+
+func TestFileSecretStore_Scopes(t *testing.T) {
+	path := writeTokenFile(t, "tokens.yaml", fmt.Sprintf(`
+tokens:
+  - name: spincloud-app
+    hash: %q
+    scopes: ["read:users/42/*", "write:uploads/*"]
+`, hashToken(t, "app-token")))
+
+	store, err := secret.NewFileSecretStore(path, newTestLogger())
+	require.NoError(t, err)
+
+	principal, err := store.ValidateToken(context.Background(), "spincloud-app.app-token")
+	require.NoError(t, err)
+	require.NotNil(t, principal)
+
+	assert.True(t, principal.Allows(secret.OpRead, "users/42/avatar.png"))
+	assert.False(t, principal.Allows(secret.OpRead, "users/43/avatar.png"))
+	assert.True(t, principal.Allows(secret.OpWrite, "uploads/scan.png"))
+	assert.False(t, principal.Allows(secret.OpDelete, "uploads/scan.png"))
+}
+
+func TestFileSecretStore_JSON(t *testing.T) {
+	path := writeTokenFile(t, "tokens.json", fmt.Sprintf(`{"tokens": [{"name": "billing", "hash": %q}]}`, hashToken(t, "billing-token")))
+
+	store, err := secret.NewFileSecretStore(path, newTestLogger())
+	require.NoError(t, err)
+
+	principal, err := store.ValidateToken(context.Background(), "billing.billing-token")
+	require.NoError(t, err)
+	assert.NotNil(t, principal)
+}
+
+func TestFileSecretStore_ReloadsOnChange(t *testing.T) {
+	hash := hashToken(t, "billing-token")
+	path := writeTokenFile(t, "tokens.yaml", fmt.Sprintf("tokens:\n  - name: billing\n    hash: %q\n", hash))
+
+	store, err := secret.NewFileSecretStore(path, newTestLogger())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go store.Watch(ctx, 10*time.Millisecond)
+
+	principal, err := store.ValidateToken(ctx, "billing.billing-token")
+	require.NoError(t, err)
+	require.NotNil(t, principal)
+
+	// a broken file keeps the previous tokens
+	require.NoError(t, os.WriteFile(path, []byte("tokens: [{name: billing, hash: plain}]"), 0o600))
+	time.Sleep(50 * time.Millisecond)
+	principal, err = store.ValidateToken(ctx, "billing.billing-token")
+	require.NoError(t, err)
+	assert.NotNil(t, principal)
+
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("tokens:\n  - name: billing\n    hash: %q\n    disabled: true\n", hash)), 0o600))
+	assert.Eventually(t, func() bool {
+		principal, err := store.ValidateToken(ctx, "billing.billing-token")
+		return err == nil && principal == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNewFileSecretStore_RejectsInvalidFiles(t *testing.T) {
+	hash := hashToken(t, "token")
+	for name, content := range map[string]string{
+		"missing name":   fmt.Sprintf("tokens:\n  - hash: %q\n", hash),
+		"duplicate name": fmt.Sprintf("tokens:\n  - name: a\n    hash: %q\n  - name: a\n    hash: %q\n", hash, hash),
+		"plain token":    "tokens:\n  - name: a\n    hash: token\n",
+		"invalid scope":  fmt.Sprintf("tokens:\n  - name: a\n    hash: %q\n    scopes: [admin]\n", hash),
+		"not yaml":       "tokens: [",
+	} {
+		path := writeTokenFile(t, "tokens.yaml", content)
+		_, err := secret.NewFileSecretStore(path, newTestLogger())
+		assert.ErrorIs(t, err, secret.ErrInvalidTokenFile, name)
+	}
+
+	_, err := secret.NewFileSecretStore(filepath.Join(t.TempDir(), "missing.yaml"), newTestLogger())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func writeTokenFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func hashToken(t *testing.T, token string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	return string(hash)
+}
+
+func newTestLogger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(io.Discard, nil))
+}
@@ -0,0 +1,400 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HMACAlgorithm is the Authorization scheme of signed requests.
+	HMACAlgorithm = "BLOBBER-HMAC-SHA256"
+
+	HeaderDate          = "X-Blobber-Date"
+	HeaderNonce         = "X-Blobber-Nonce"
+	HeaderContentSHA256 = "X-Blobber-Content-Sha256"
+
+	// DefaultHMACMaxSkew is how far the request date may be off the server clock.
+	DefaultHMACMaxSkew = 5 * time.Minute
+	// MinHMACSecretLength is the shortest signing secret accepted, in bytes.
+	MinHMACSecretLength = 32
+
+	minNonceLength = 16
+	maxNonceLength = 128
+	// maxNonces bounds the replay cache; requests are rejected while it is full.
+	maxNonces = 1 << 20
+	// noncePurgeInterval is how often expired nonces are dropped from the cache.
+	noncePurgeInterval = time.Minute
+	// maxBufferedBodySize is the largest body verified in memory; larger bodies
+	// are staged in a temporary file.
+	maxBufferedBodySize = 1 << 20
+)
+
+// signedHeaders are the request headers covered by the signature, besides the
+// date, nonce and content hash.
+var signedHeaders = []string{"Content-Type", "If-Match", "If-None-Match", "Range"}
+
+var (
+	ErrInvalidHMACConfig = errors.New("invalid HMAC auth config")
+	ErrBodyHashMismatch  = errors.New("request body does not match the signed content hash")
+)
+
+// emptyBodyHash is the content hash of requests without a body.
+var emptyBodyHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+// HMACKey is a signing key shared with one client.
+type HMACKey struct {
+	ID string `yaml:"id"`
+	// SecretEnvVar names the environment variable holding the secret.
+	SecretEnvVar string `yaml:"secret_env_var"`
+	// Scopes like "read:users/42/*" limit the key; without scopes it has full access.
+	Scopes []string `yaml:"scopes"`
+}
+
+// HMACConfig configures request signing.
+type HMACConfig struct {
+	Keys []HMACKey `yaml:"keys"`
+	// MaxSkew is how far the request date may be off the server clock; it
+	// defaults to 5 minutes.
+	MaxSkew time.Duration `yaml:"max_skew"`
+	// SpoolDir holds bodies larger than 1MB until they are verified; it
+	// defaults to the system temp directory.
+	SpoolDir string `yaml:"spool_dir"`
+}
+
+type hmacKey struct {
+	secret    []byte
+	principal *Principal
+}
+
+// HMACSecretStore authenticates requests signed with a shared secret. The
+// signature covers the method, path, query, the headers in signedHeaders, date,
+// a nonce and the SHA-256 of the body, so leaked requests can be neither
+// altered nor replayed.
+type HMACSecretStore struct {
+	keys     map[string]hmacKey
+	maxSkew  time.Duration
+	spoolDir string
+	logger   *slog.Logger
+
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastPurge time.Time
+}
+
+// NewHMACSecretStore reads the secrets of the configured keys from the environment.
+func NewHMACSecretStore(config HMACConfig, logger *slog.Logger) (*HMACSecretStore, error) {
+	if len(config.Keys) == 0 {
+		return nil, fmt.Errorf("%w: no keys configured", ErrInvalidHMACConfig)
+	}
+
+	if config.MaxSkew <= 0 {
+		config.MaxSkew = DefaultHMACMaxSkew
+	}
+
+	s := &HMACSecretStore{
+		keys:     make(map[string]hmacKey, len(config.Keys)),
+		maxSkew:  config.MaxSkew,
+		spoolDir: config.SpoolDir,
+		logger:   logger,
+		nonces:   make(map[string]time.Time),
+	}
+
+	for _, key := range config.Keys {
+		if key.ID == "" || strings.ContainsAny(key.ID, ", =") {
+			return nil, fmt.Errorf("%w: key id %q must be set and may not contain commas, spaces or =", ErrInvalidHMACConfig, key.ID)
+		}
+
+		if _, ok := s.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%w: duplicate key id %q", ErrInvalidHMACConfig, key.ID)
+		}
+
+		secret := os.Getenv(key.SecretEnvVar)
+		if len(secret) < MinHMACSecretLength {
+			return nil, fmt.Errorf("%w: the secret of key %q must be at least %d bytes", ErrInvalidHMACConfig, key.ID, MinHMACSecretLength)
+		}
+
+		principal := FullAccess(key.ID)
+		if len(key.Scopes) > 0 {
+			var err error
+			if principal, err = NewPrincipal(key.ID, key.Scopes); err != nil {
+				return nil, fmt.Errorf("%w: key %q: %w", ErrInvalidHMACConfig, key.ID, err)
+			}
+		}
+
+		s.keys[key.ID] = hmacKey{secret: []byte(secret), principal: principal}
+	}
+
+	return s, nil
+}
+
+// ValidateToken rejects every static token; requests have to be signed.
+func (s *HMACSecretStore) ValidateToken(ctx context.Context, token string) (*Principal, error) {
+	return nil, nil
+}
+
+// AuthenticateRequest checks the signature, date and nonce of a request. The
+// body is read and verified against the signed content hash before the request
+// is handled, so handlers never act on altered content; bodies that do not
+// match fail with ErrBodyHashMismatch. The returned request carries the staged
+// body, which has to be closed once the request is served.
+func (s *HMACSecretStore) AuthenticateRequest(r *http.Request) (*Principal, *http.Request, error) {
+	keyID, signature, ok := parseHMACAuthorization(r.Header.Get("Authorization"))
+	if !ok {
+		return nil, r, nil
+	}
+
+	key, ok := s.keys[keyID]
+	if !ok {
+		s.logger.Debug("Signed request rejected, unknown key", slog.String("key_id", keyID))
+		return nil, r, nil
+	}
+
+	date, err := time.Parse(time.RFC3339, r.Header.Get(HeaderDate))
+	now := time.Now()
+	if err != nil || date.Before(now.Add(-s.maxSkew)) || date.After(now.Add(s.maxSkew)) {
+		s.logger.Debug("Signed request rejected, date missing or outside the allowed skew", slog.String("key_id", keyID))
+		return nil, r, nil
+	}
+
+	nonce := r.Header.Get(HeaderNonce)
+	if !validNonce(nonce) {
+		s.logger.Debug("Signed request rejected, invalid nonce", slog.String("key_id", keyID))
+		return nil, r, nil
+	}
+
+	bodyHash := strings.ToLower(r.Header.Get(HeaderContentSHA256))
+	if bodyHash == "" {
+		bodyHash = emptyBodyHash
+	}
+
+	want, err := hex.DecodeString(bodyHash)
+	if err != nil || len(want) != sha256.Size {
+		s.logger.Debug("Signed request rejected, invalid content hash", slog.String("key_id", keyID))
+		return nil, r, nil
+	}
+
+	expected := signHMAC(key.secret, requestStringToSign(r, r.Header.Get(HeaderDate), nonce, bodyHash))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		s.logger.Debug("Signed request rejected, signature mismatch", slog.String("key_id", keyID))
+		return nil, r, nil
+	}
+
+	// nonces are only remembered for valid signatures, so they cannot be used to fill the cache
+	if !s.rememberNonce(keyID+":"+nonce, date.Add(s.maxSkew), now) {
+		s.logger.Warn("Signed request rejected, nonce replayed", slog.String("key_id", keyID))
+		return nil, r, nil
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		if bodyHash != emptyBodyHash {
+			s.logger.Debug("Signed request rejected, body missing", slog.String("key_id", keyID))
+			return nil, r, nil
+		}
+
+		return key.principal, r, nil
+	}
+
+	body, size, err := s.stageBody(r.Body, want)
+	if err != nil {
+		if errors.Is(err, ErrBodyHashMismatch) {
+			s.logger.Warn("Signed request rejected, body does not match the content hash", slog.String("key_id", keyID))
+		}
+		return nil, r, err
+	}
+
+	verified := r.Clone(r.Context())
+	verified.Body = body
+	verified.ContentLength = size
+	return key.principal, verified, nil
+}
+
+// stageBody reads the whole body and checks it against the signed hash. Small
+// bodies are kept in memory, larger ones in a temporary file that is removed
+// when the returned body is closed.
+func (s *HMACSecretStore) stageBody(body io.Reader, want []byte) (io.ReadCloser, int64, error) {
+	hash := sha256.New()
+	head, err := io.ReadAll(io.LimitReader(io.TeeReader(body, hash), maxBufferedBodySize+1))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(head) <= maxBufferedBodySize {
+		if !hmac.Equal(hash.Sum(nil), want) {
+			return nil, 0, ErrBodyHashMismatch
+		}
+
+		return io.NopCloser(bytes.NewReader(head)), int64(len(head)), nil
+	}
+
+	file, err := os.CreateTemp(s.spoolDir, "blobber-body-*")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	staged := &stagedBody{File: file}
+	size, err := io.Copy(file, io.MultiReader(bytes.NewReader(head), io.TeeReader(body, hash)))
+	if err == nil && !hmac.Equal(hash.Sum(nil), want) {
+		err = ErrBodyHashMismatch
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		staged.Close()
+		return nil, 0, err
+	}
+
+	return staged, size, nil
+}
+
+// rememberNonce records a nonce until it expires; it reports false for a
+// replayed nonce or when the cache is full.
+func (s *HMACSecretStore) rememberNonce(nonce string, expires, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastPurge) >= noncePurgeInterval || len(s.nonces) >= maxNonces {
+		for seen, expiresAt := range s.nonces {
+			if now.After(expiresAt) {
+				delete(s.nonces, seen)
+			}
+		}
+		s.lastPurge = now
+	}
+
+	if expiresAt, ok := s.nonces[nonce]; ok && !now.After(expiresAt) {
+		return false
+	}
+
+	if len(s.nonces) >= maxNonces {
+		return false
+	}
+
+	s.nonces[nonce] = expires
+	return true
+}
+
+// SignRequest signs a request for a server using the hmac provider. The body
+// is read to hash it and replaced by an identical one. Content-Type, If-Match,
+// If-None-Match and Range are signed, so they have to be set before.
+func SignRequest(r *http.Request, keyID string, secret []byte) error {
+	bodyHash := emptyBodyHash
+	if r.Body != nil && r.Body != http.NoBody {
+		content, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(content)
+		bodyHash = hex.EncodeToString(sum[:])
+		r.Body = io.NopCloser(bytes.NewReader(content))
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	date := time.Now().UTC().Format(time.RFC3339)
+	r.Header.Set(HeaderDate, date)
+	r.Header.Set(HeaderNonce, hex.EncodeToString(nonce))
+	r.Header.Set(HeaderContentSHA256, bodyHash)
+
+	signature := signHMAC(secret, requestStringToSign(r, date, r.Header.Get(HeaderNonce), bodyHash))
+	r.Header.Set("Authorization", fmt.Sprintf("%s KeyId=%s, Signature=%s", HMACAlgorithm, keyID, signature))
+	return nil
+}
+
+// requestStringToSign joins the signed parts of a request with newlines. The
+// query is canonicalized by sorting the parameters by name, and each signed
+// header is added as "<lowercase name>:<values joined by commas>".
+func requestStringToSign(r *http.Request, date, nonce, bodyHash string) string {
+	parts := []string{
+		HMACAlgorithm,
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.Query().Encode(),
+		date,
+		nonce,
+		bodyHash,
+	}
+	for _, name := range signedHeaders {
+		parts = append(parts, strings.ToLower(name)+":"+strings.Join(r.Header.Values(name), ","))
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+func signHMAC(secret []byte, message string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseHMACAuthorization parses "BLOBBER-HMAC-SHA256 KeyId=<id>, Signature=<hex>".
+func parseHMACAuthorization(header string) (keyID, signature string, ok bool) {
+	scheme, params, found := strings.Cut(header, " ")
+	if !found || scheme != HMACAlgorithm {
+		return "", "", false
+	}
+
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch name {
+		case "KeyId":
+			keyID = value
+		case "Signature":
+			signature = strings.ToLower(value)
+		}
+	}
+
+	return keyID, signature, keyID != "" && signature != ""
+}
+
+func validNonce(nonce string) bool {
+	if len(nonce) < minNonceLength || len(nonce) > maxNonceLength {
+		return false
+	}
+
+	for _, r := range nonce {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stagedBody is a verified body spooled to a temporary file.
+type stagedBody struct {
+	*os.File
+	closed bool
+}
+
+func (b *stagedBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	err := b.File.Close()
+	if removeErr := os.Remove(b.File.Name()); err == nil {
+		err = removeErr
+	}
+
+	return err
+}
@@ -0,0 +1,207 @@
+package secret_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timgluz/blobber/pkg/secret"
+)
+
+const testHMACSecret = "0123456789abcdef0123456789abcdef"
+
+func TestHMACSecretStore_AuthenticatesSignedRequests(t *testing.T) {
+	handler, principal := newTestHMACHandler(t)
+
+	signed := func(method, target, body string) *http.Request {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		require.NoError(t, secret.SignRequest(req, "billing", []byte(testHMACSecret)))
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		want    int
+	}{
+		{name: "signed", request: func() *http.Request {
+			return signed(http.MethodGet, "/blobs?prefix=a/&limit=2", "")
+		}, want: http.StatusOK},
+		{name: "signed with body", request: func() *http.Request {
+			return signed(http.MethodPut, "/blobs/a.txt", "hello")
+		}, want: http.StatusOK},
+		{name: "unsigned", request: func() *http.Request {
+			return httptest.NewRequest(http.MethodGet, "/blobs", nil)
+		}, want: http.StatusUnauthorized},
+		{name: "static token", request: func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/blobs", nil)
+			req.Header.Set("X-API-Token", testHMACSecret)
+			return req
+		}, want: http.StatusUnauthorized},
+		{name: "unknown key", request: func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/blobs", nil)
+			require.NoError(t, secret.SignRequest(req, "other", []byte(testHMACSecret)))
+			return req
+		}, want: http.StatusUnauthorized},
+		{name: "wrong secret", request: func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/blobs", nil)
+			require.NoError(t, secret.SignRequest(req, "billing", []byte(strings.Repeat("x", 32))))
+			return req
+		}, want: http.StatusUnauthorized},
+		{name: "altered query", request: func() *http.Request {
+			req := signed(http.MethodGet, "/blobs?prefix=a/", "")
+			req.URL.RawQuery = "prefix=b/"
+			return req
+		}, want: http.StatusUnauthorized},
+		{name: "altered method", request: func() *http.Request {
+			req := signed(http.MethodGet, "/blobs/a.txt", "")
+			req.Method = http.MethodDelete
+			return req
+		}, want: http.StatusUnauthorized},
+		{name: "altered content type", request: func() *http.Request {
+			req := httptest.NewRequest(http.MethodPut, "/blobs/a.txt", strings.NewReader("hello"))
+			req.Header.Set("Content-Type", "text/plain")
+			require.NoError(t, secret.SignRequest(req, "billing", []byte(testHMACSecret)))
+			req.Header.Set("Content-Type", "text/html")
+			return req
+		}, want: http.StatusUnauthorized},
+		{name: "dropped precondition", request: func() *http.Request {
+			req := httptest.NewRequest(http.MethodPut, "/blobs/a.txt", strings.NewReader("hello"))
+			req.Header.Set("If-None-Match", "*")
+			require.NoError(t, secret.SignRequest(req, "billing", []byte(testHMACSecret)))
+			req.Header.Del("If-None-Match")
+			return req
+		}, want: http.StatusUnauthorized},
+		{name: "added range", request: func() *http.Request {
+			req := signed(http.MethodGet, "/blobs/a.txt", "")
+			req.Header.Set("Range", "bytes=0-1")
+			return req
+		}, want: http.StatusUnauthorized},
+		{name: "stale date", request: func() *http.Request {
+			req := signed(http.MethodGet, "/blobs", "")
+			req.Header.Set(secret.HeaderDate, time.Now().Add(-10*time.Minute).UTC().Format(time.RFC3339))
+			return req
+		}, want: http.StatusUnauthorized},
+		{name: "missing nonce", request: func() *http.Request {
+			req := signed(http.MethodGet, "/blobs", "")
+			req.Header.Del(secret.HeaderNonce)
+			return req
+		}, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*principal = nil
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.request())
+
+			assert.Equal(t, tt.want, rec.Code)
+			if tt.want == http.StatusOK {
+				require.NotNil(t, *principal)
+				assert.Equal(t, "billing", (*principal).Name)
+			}
+		})
+	}
+}
+
+func TestHMACSecretStore_RejectsReplayedNonce(t *testing.T) {
+	handler, _ := newTestHMACHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/blobs", nil)
+	require.NoError(t, secret.SignRequest(req, "billing", []byte(testHMACSecret)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	replay := httptest.NewRequest(http.MethodGet, "/blobs", nil)
+	replay.Header = req.Header.Clone()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, replay)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestHMACSecretStore_VerifiesBodyBeforeHandling(t *testing.T) {
+	handler, principal := newTestHMACHandler(t)
+
+	small := strings.Repeat("a", 5)
+	large := strings.Repeat("a", 3<<20)
+	for name, body := range map[string]string{"buffered": small, "staged": large} {
+		t.Run(name, func(t *testing.T) {
+			*principal = nil
+			req := httptest.NewRequest(http.MethodPut, "/blobs/a.txt", strings.NewReader(body))
+			require.NoError(t, secret.SignRequest(req, "billing", []byte(testHMACSecret)))
+			req.Body = io.NopCloser(strings.NewReader(strings.Replace(body, "a", "b", 1)))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), secret.ErrBodyHashMismatch.Error())
+			assert.Nil(t, *principal, "the handler must not run")
+
+			req = httptest.NewRequest(http.MethodPut, "/blobs/a.txt", strings.NewReader(body))
+			require.NoError(t, secret.SignRequest(req, "billing", []byte(testHMACSecret)))
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.NotNil(t, *principal)
+		})
+	}
+}
+
+func TestNewHMACSecretStore_RejectsInvalidConfig(t *testing.T) {
+	t.Setenv("TEST_HMAC_SECRET", testHMACSecret)
+	t.Setenv("TEST_HMAC_SHORT_SECRET", "too-short")
+
+	tests := []struct {
+		name   string
+		config secret.HMACConfig
+	}{
+		{name: "no keys", config: secret.HMACConfig{}},
+		{name: "short secret", config: secret.HMACConfig{Keys: []secret.HMACKey{{ID: "a", SecretEnvVar: "TEST_HMAC_SHORT_SECRET"}}}},
+		{name: "missing secret", config: secret.HMACConfig{Keys: []secret.HMACKey{{ID: "a", SecretEnvVar: "TEST_HMAC_UNSET"}}}},
+		{name: "invalid id", config: secret.HMACConfig{Keys: []secret.HMACKey{{ID: "a,b", SecretEnvVar: "TEST_HMAC_SECRET"}}}},
+		{name: "duplicate id", config: secret.HMACConfig{Keys: []secret.HMACKey{
+			{ID: "a", SecretEnvVar: "TEST_HMAC_SECRET"},
+			{ID: "a", SecretEnvVar: "TEST_HMAC_SECRET"},
+		}}},
+		{name: "invalid scope", config: secret.HMACConfig{Keys: []secret.HMACKey{
+			{ID: "a", SecretEnvVar: "TEST_HMAC_SECRET", Scopes: []string{"admin:*"}},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := secret.NewHMACSecretStore(tt.config, newTestLogger())
+			assert.ErrorIs(t, err, secret.ErrInvalidHMACConfig)
+		})
+	}
+}
+
+// newTestHMACHandler returns a handler behind the HMAC provider that reads the
+// request body and records the principal.
+func newTestHMACHandler(t *testing.T) (http.Handler, **secret.Principal) {
+	t.Helper()
+
+	t.Setenv("TEST_HMAC_SECRET", testHMACSecret)
+	store, err := secret.NewHMACSecretStore(secret.HMACConfig{
+		Keys: []secret.HMACKey{{ID: "billing", SecretEnvVar: "TEST_HMAC_SECRET"}},
+	}, newTestLogger())
+	require.NoError(t, err)
+
+	principal := new(*secret.Principal)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*principal, _ = secret.PrincipalFromContext(r.Context())
+	})
+
+	return secret.NewAPITokenMiddleware(store, newTestLogger()).Handler(next), principal
+}
@@ -0,0 +1,375 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultJWKSRefreshInterval is how often the JWKS is reloaded.
+	DefaultJWKSRefreshInterval = 5 * time.Minute
+
+	// minJWKSRefreshInterval limits the reloads triggered by tokens with an
+	// unknown key ID.
+	minJWKSRefreshInterval = time.Minute
+	// maxJWKSSize bounds the JWKS document fetched from a URL.
+	maxJWKSSize = 1 << 20
+)
+
+var (
+	ErrInvalidJWTConfig = errors.New("invalid JWT auth config")
+	ErrJWKSUnavailable  = errors.New("JWKS unavailable")
+)
+
+// jwtSigningMethods are the accepted signature algorithms. Only asymmetric ones
+// are listed, so a public key can never be used as an HMAC secret.
+var jwtSigningMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// JWTConfig configures the validation of bearer JWTs.
+type JWTConfig struct {
+	// JWKSFile or JWKSURL locate the keys the tokens are signed with; exactly one is required.
+	JWKSFile string `yaml:"jwks_file"`
+	JWKSURL  string `yaml:"jwks_url"`
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// Scopes are scope templates; "{claim}" is replaced by the value of the claim,
+	// e.g. "*:users/{sub}/*".
+	Scopes []string `yaml:"scopes"`
+	// ScopesClaim names a claim holding scopes like "read:reports/*", either as a
+	// space separated string or as a list. Values of another form are ignored.
+	ScopesClaim string `yaml:"scopes_claim"`
+	// RefreshInterval is how often the JWKS is reloaded, to pick up rotated keys.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// Leeway tolerates clock skew when checking the exp, nbf and iat claims.
+	Leeway time.Duration `yaml:"leeway"`
+}
+
+// JWTSecretStore validates JWTs against the keys of a JWKS and maps their claims
+// to a principal with scopes.
+type JWTSecretStore struct {
+	config JWTConfig
+	parser *jwt.Parser
+	client *http.Client
+	logger *slog.Logger
+
+	// refreshMu serializes JWKS reloads.
+	refreshMu sync.Mutex
+
+	mu   sync.RWMutex
+	keys jose.JSONWebKeySet
+	// lastMissRefresh is when an unknown kid last reloaded the JWKS.
+	lastMissRefresh time.Time
+}
+
+// NewJWTSecretStore validates the config and loads the JWKS; it fails when the
+// JWKS cannot be loaded.
+func NewJWTSecretStore(ctx context.Context, config JWTConfig, logger *slog.Logger) (*JWTSecretStore, error) {
+	if (config.JWKSFile == "") == (config.JWKSURL == "") {
+		return nil, fmt.Errorf("%w: exactly one of jwks_file and jwks_url is required", ErrInvalidJWTConfig)
+	}
+
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, fmt.Errorf("%w: issuer and audience are required", ErrInvalidJWTConfig)
+	}
+
+	if len(config.Scopes) == 0 && config.ScopesClaim == "" {
+		return nil, fmt.Errorf("%w: scopes or scopes_claim is required", ErrInvalidJWTConfig)
+	}
+
+	for _, template := range config.Scopes {
+		if _, err := expandScope(template, func(string) string { return "claim" }); err != nil {
+			return nil, fmt.Errorf("%w: scope %q: %w", ErrInvalidJWTConfig, template, err)
+		}
+	}
+
+	s := &JWTSecretStore{
+		config: config,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(jwtSigningMethods),
+			jwt.WithIssuer(config.Issuer),
+			jwt.WithAudience(config.Audience),
+			jwt.WithExpirationRequired(),
+			jwt.WithLeeway(config.Leeway),
+		),
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger,
+	}
+
+	if err := s.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *JWTSecretStore) ValidateToken(ctx context.Context, token string) (*Principal, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := s.parser.ParseWithClaims(token, claims, s.keyFunc(ctx)); err != nil {
+		if errors.Is(err, ErrJWKSUnavailable) {
+			return nil, err
+		}
+
+		s.logger.Debug("JWT rejected", slog.Any("error", err))
+		return nil, nil
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		s.logger.Debug("JWT rejected, it has no subject")
+		return nil, nil
+	}
+
+	return &Principal{Name: subject, Scopes: s.scopes(claims)}, nil
+}
+
+// Watch reloads the JWKS every interval until the context is cancelled. A JWKS
+// that fails to load keeps the previous keys active.
+func (s *JWTSecretStore) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultJWKSRefreshInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.refresh(ctx); err != nil {
+				s.logger.Error("Reloading JWKS failed", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// keyFunc looks up the verification key by the kid header. An unknown kid
+// reloads the JWKS first, as the issuer may have rotated its keys.
+func (s *JWTSecretStore) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := s.lookup(kid, token.Method.Alg()); ok {
+			return key, nil
+		}
+
+		s.mu.Lock()
+		stale := time.Since(s.lastMissRefresh) >= minJWKSRefreshInterval
+		if stale {
+			s.lastMissRefresh = time.Now()
+		}
+		s.mu.Unlock()
+
+		if stale {
+			if err := s.refresh(ctx); err != nil {
+				return nil, err
+			}
+
+			if key, ok := s.lookup(kid, token.Method.Alg()); ok {
+				return key, nil
+			}
+		}
+
+		return nil, fmt.Errorf("no signing key with kid %q", kid)
+	}
+}
+
+func (s *JWTSecretStore) lookup(kid, alg string) (any, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	candidates := s.keys.Keys
+	if kid != "" {
+		candidates = s.keys.Key(kid)
+	} else if len(candidates) != 1 {
+		// without a kid, only a single key set is unambiguous
+		return nil, false
+	}
+
+	for _, key := range candidates {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		if key.Algorithm != "" && key.Algorithm != alg {
+			continue
+		}
+
+		public := key.Public()
+		if !public.Valid() {
+			continue
+		}
+
+		return public.Key, true
+	}
+
+	return nil, false
+}
+
+func (s *JWTSecretStore) refresh(ctx context.Context) error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	keys, err := s.loadJWKS(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrJWKSUnavailable, err)
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	s.logger.Debug("Loaded JWKS", slog.Int("keys", len(keys.Keys)))
+	return nil
+}
+
+func (s *JWTSecretStore) loadJWKS(ctx context.Context) (jose.JSONWebKeySet, error) {
+	var keys jose.JSONWebKeySet
+
+	var content []byte
+	if s.config.JWKSFile != "" {
+		var err error
+		if content, err = os.ReadFile(s.config.JWKSFile); err != nil {
+			return keys, err
+		}
+	} else {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.JWKSURL, nil)
+		if err != nil {
+			return keys, err
+		}
+
+		res, err := s.client.Do(req)
+		if err != nil {
+			return keys, err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return keys, fmt.Errorf("fetching %s: unexpected status %s", s.config.JWKSURL, res.Status)
+		}
+
+		if content, err = io.ReadAll(io.LimitReader(res.Body, maxJWKSSize)); err != nil {
+			return keys, err
+		}
+	}
+
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return keys, err
+	}
+
+	if len(keys.Keys) == 0 {
+		return keys, errors.New("the JWKS has no keys")
+	}
+
+	return keys, nil
+}
+
+// scopes expands the scope templates and adds the scopes of the scopes claim.
+// Templates referring to missing or unsafe claim values are skipped.
+func (s *JWTSecretStore) scopes(claims jwt.MapClaims) []Scope {
+	var scopes []Scope
+	for _, template := range s.config.Scopes {
+		scope, err := expandScope(template, claimSegment(claims))
+		if err != nil {
+			s.logger.Debug("Skipping JWT scope", slog.String("scope", template), slog.Any("error", err))
+			continue
+		}
+		scopes = append(scopes, scope)
+	}
+
+	if s.config.ScopesClaim == "" {
+		return scopes
+	}
+
+	var values []string
+	switch claim := claims[s.config.ScopesClaim].(type) {
+	case string:
+		values = strings.Fields(claim)
+	case []any:
+		for _, value := range claim {
+			if value, ok := value.(string); ok {
+				values = append(values, value)
+			}
+		}
+	}
+
+	for _, value := range values {
+		// identity providers mix in scopes like "openid", which are not ours
+		if scope, err := ParseScope(value); err == nil {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
+
+// expandScope replaces the "{claim}" placeholders of a scope template with the
+// values returned by lookup and parses the result; an empty value fails.
+func expandScope(template string, lookup func(string) string) (Scope, error) {
+	var expanded strings.Builder
+	rest := template
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			expanded.WriteString(rest)
+			break
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return Scope{}, fmt.Errorf("%w: unclosed placeholder", ErrInvalidScope)
+		}
+
+		name := rest[start+1 : start+end]
+		value := lookup(name)
+		if value == "" {
+			return Scope{}, fmt.Errorf("claim %q is missing or not a safe key segment", name)
+		}
+
+		expanded.WriteString(rest[:start])
+		expanded.WriteString(value)
+		rest = rest[start+end+1:]
+	}
+
+	return ParseScope(expanded.String())
+}
+
+// claimSegment returns a lookup of string claims that are usable as a single
+// key segment, so a claim value can never widen a scope to other keys.
+func claimSegment(claims jwt.MapClaims) func(string) string {
+	return func(name string) string {
+		value, _ := claims[name].(string)
+		if value == "." || value == ".." || strings.ContainsAny(value, "/\\*{}") {
+			return ""
+		}
+
+		for _, r := range value {
+			if r < 0x20 || r == 0x7f {
+				return ""
+			}
+		}
+
+		return value
+	}
+}
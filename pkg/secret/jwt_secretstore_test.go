@@ -0,0 +1,248 @@
+package secret_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timgluz/blobber/pkg/secret"
+)
+
+func TestJWTSecretStore_ValidateToken(t *testing.T) {
+	key := newTestSigningKey(t, "k1")
+	config := newTestJWTConfig(t, writeJWKS(t, key))
+	config.ScopesClaim = "scope"
+
+	store, err := secret.NewJWTSecretStore(context.Background(), config, newTestLogger())
+	require.NoError(t, err)
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   "https://issuer.example.com",
+			"aud":   "blobber",
+			"sub":   "42",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": "openid read:shared/*",
+		}
+	}
+
+	principal, err := store.ValidateToken(context.Background(), key.sign(t, valid()))
+	require.NoError(t, err)
+	require.NotNil(t, principal)
+	assert.Equal(t, "42", principal.Name)
+	assert.True(t, principal.Allows(secret.OpWrite, "users/42/avatar.png"))
+	assert.False(t, principal.Allows(secret.OpWrite, "users/7/avatar.png"))
+	assert.True(t, principal.Allows(secret.OpRead, "shared/logo.png"))
+	assert.False(t, principal.Allows(secret.OpWrite, "shared/logo.png"))
+
+	other := newTestSigningKey(t, "k1")
+	tests := []struct {
+		name   string
+		token  func() string
+		reject bool
+	}{
+		{name: "wrong issuer", token: func() string {
+			claims := valid()
+			claims["iss"] = "https://evil.example.com"
+			return key.sign(t, claims)
+		}},
+		{name: "wrong audience", token: func() string {
+			claims := valid()
+			claims["aud"] = "other-service"
+			return key.sign(t, claims)
+		}},
+		{name: "expired", token: func() string {
+			claims := valid()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return key.sign(t, claims)
+		}},
+		{name: "missing expiry", token: func() string {
+			claims := valid()
+			delete(claims, "exp")
+			return key.sign(t, claims)
+		}},
+		{name: "missing subject", token: func() string {
+			claims := valid()
+			delete(claims, "sub")
+			return key.sign(t, claims)
+		}},
+		{name: "foreign key", token: func() string {
+			return other.sign(t, valid())
+		}},
+		{name: "hmac signed", token: func() string {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("secret"))
+			require.NoError(t, err)
+			return token
+		}},
+		{name: "garbage", token: func() string { return "not-a-jwt" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := store.ValidateToken(context.Background(), tt.token())
+			require.NoError(t, err)
+			assert.Nil(t, principal)
+		})
+	}
+}
+
+func TestJWTSecretStore_SkipsUnsafeClaimValues(t *testing.T) {
+	key := newTestSigningKey(t, "k1")
+	store, err := secret.NewJWTSecretStore(context.Background(), newTestJWTConfig(t, writeJWKS(t, key)), newTestLogger())
+	require.NoError(t, err)
+
+	token := key.sign(t, jwt.MapClaims{
+		"iss": "https://issuer.example.com",
+		"aud": "blobber",
+		"sub": "../7",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	principal, err := store.ValidateToken(context.Background(), token)
+	require.NoError(t, err)
+	require.NotNil(t, principal)
+	assert.Empty(t, principal.Scopes)
+	assert.False(t, principal.Allows(secret.OpRead, "users/7/avatar.png"))
+}
+
+func TestJWTSecretStore_ReloadsJWKSForUnknownKey(t *testing.T) {
+	first := newTestSigningKey(t, "k1")
+	rotated := newTestSigningKey(t, "k2")
+
+	var current atomic.Pointer[testSigningKey]
+	current.Store(first)
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		require.NoError(t, json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{current.Load().jwk()}}))
+	}))
+	defer server.Close()
+
+	config := newTestJWTConfig(t, "")
+	config.JWKSFile = ""
+	config.JWKSURL = server.URL
+
+	store, err := secret.NewJWTSecretStore(context.Background(), config, newTestLogger())
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{
+		"iss": "https://issuer.example.com",
+		"aud": "blobber",
+		"sub": "42",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	current.Store(rotated)
+	principal, err := store.ValidateToken(context.Background(), rotated.sign(t, claims))
+	require.NoError(t, err)
+	require.NotNil(t, principal)
+	assert.Equal(t, int32(2), fetches.Load())
+
+	// unknown keys trigger at most one reload per minute
+	principal, err = store.ValidateToken(context.Background(), newTestSigningKey(t, "k3").sign(t, claims))
+	require.NoError(t, err)
+	assert.Nil(t, principal)
+	assert.Equal(t, int32(2), fetches.Load())
+}
+
+func TestNewJWTSecretStore_RejectsInvalidConfig(t *testing.T) {
+	jwks := writeJWKS(t, newTestSigningKey(t, "k1"))
+
+	tests := []struct {
+		name   string
+		modify func(*secret.JWTConfig)
+	}{
+		{name: "no jwks", modify: func(c *secret.JWTConfig) { c.JWKSFile = "" }},
+		{name: "file and url", modify: func(c *secret.JWTConfig) { c.JWKSURL = "https://issuer.example.com/jwks" }},
+		{name: "no issuer", modify: func(c *secret.JWTConfig) { c.Issuer = "" }},
+		{name: "no audience", modify: func(c *secret.JWTConfig) { c.Audience = "" }},
+		{name: "no scopes", modify: func(c *secret.JWTConfig) { c.Scopes = nil }},
+		{name: "invalid scope", modify: func(c *secret.JWTConfig) { c.Scopes = []string{"admin:{sub}/*"} }},
+		{name: "unclosed placeholder", modify: func(c *secret.JWTConfig) { c.Scopes = []string{"read:users/{sub/*"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestJWTConfig(t, jwks)
+			tt.modify(&config)
+
+			_, err := secret.NewJWTSecretStore(context.Background(), config, newTestLogger())
+			assert.ErrorIs(t, err, secret.ErrInvalidJWTConfig)
+		})
+	}
+
+	config := newTestJWTConfig(t, filepath.Join(t.TempDir(), "missing.json"))
+	_, err := secret.NewJWTSecretStore(context.Background(), config, newTestLogger())
+	assert.ErrorIs(t, err, secret.ErrJWKSUnavailable)
+}
+
+type testSigningKey struct {
+	kid string
+	key *ecdsa.PrivateKey
+}
+
+func newTestSigningKey(t *testing.T, kid string) *testSigningKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return &testSigningKey{kid: kid, key: key}
+}
+
+func (k *testSigningKey) jwk() jose.JSONWebKey {
+	return jose.JSONWebKey{Key: &k.key.PublicKey, KeyID: k.kid, Algorithm: "ES256", Use: "sig"}
+}
+
+func (k *testSigningKey) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = k.kid
+
+	signed, err := token.SignedString(k.key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func writeJWKS(t *testing.T, keys ...*testSigningKey) string {
+	t.Helper()
+
+	set := jose.JSONWebKeySet{}
+	for _, key := range keys {
+		set.Keys = append(set.Keys, key.jwk())
+	}
+
+	content, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	return path
+}
+
+func newTestJWTConfig(t *testing.T, jwksFile string) secret.JWTConfig {
+	t.Helper()
+
+	return secret.JWTConfig{
+		JWKSFile: jwksFile,
+		Issuer:   "https://issuer.example.com",
+		Audience: "blobber",
+		Scopes:   []string{"*:users/{sub}/*"},
+	}
+}
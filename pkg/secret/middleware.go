@@ -1,8 +1,10 @@
 package secret
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
+	"strings"
 )
 
 type APITokenMiddleware struct {
@@ -16,23 +18,53 @@ func NewAPITokenMiddleware(store SecretStore, logger *slog.Logger) *APITokenMidd
 
 func (m *APITokenMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("X-API-Token")
-		if token == "" {
-			http.Error(w, "Missing API token", http.StatusUnauthorized)
+		var principal *Principal
+		var err error
+		if authenticator, ok := m.store.(RequestAuthenticator); ok {
+			principal, r, err = authenticator.AuthenticateRequest(r)
+			// releases bodies the authenticator staged; the server only closes the original
+			if r.Body != nil {
+				defer r.Body.Close()
+			}
+		} else {
+			token := requestToken(r)
+			if token == "" {
+				http.Error(w, "Missing API token", http.StatusUnauthorized)
+				return
+			}
+
+			principal, err = m.store.ValidateToken(r.Context(), token)
+		}
+		if errors.Is(err, ErrBodyHashMismatch) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		valid, err := m.store.ValidateToken(r.Context(), token)
 		if err != nil {
 			http.Error(w, "Error validating API token", http.StatusInternalServerError)
 			return
 		}
 
-		if !valid {
+		if principal == nil {
 			http.Error(w, "Invalid API token", http.StatusUnauthorized)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
 	})
 }
+
+// requestToken reads the token from the X-API-Token header or, failing that,
+// from an "Authorization: Bearer" header.
+func requestToken(r *http.Request) string {
+	if token := r.Header.Get("X-API-Token"); token != "" {
+		return token
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,46 @@
+package secret_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timgluz/blobber/pkg/secret"
+)
+
+func TestAPITokenMiddleware_ReadsTokenHeaders(t *testing.T) {
+	t.Setenv("TEST_BLOBBER_TOKEN", "s3cret")
+	middleware := secret.NewAPITokenMiddleware(secret.NewEnvSecretStore("TEST_BLOBBER_TOKEN"), newTestLogger())
+
+	var principal *secret.Principal
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = secret.PrincipalFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{name: "api token", header: http.Header{"X-Api-Token": {"s3cret"}}, want: http.StatusOK},
+		{name: "bearer token", header: http.Header{"Authorization": {"Bearer s3cret"}}, want: http.StatusOK},
+		{name: "wrong bearer token", header: http.Header{"Authorization": {"Bearer nope"}}, want: http.StatusUnauthorized},
+		{name: "basic auth", header: http.Header{"Authorization": {"Basic s3cret"}}, want: http.StatusUnauthorized},
+		{name: "no token", header: http.Header{}, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal = nil
+			req := httptest.NewRequest(http.MethodGet, "/blobs", nil)
+			req.Header = tt.header
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Equal(t, tt.want == http.StatusOK, principal != nil)
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Operation is an action a scope grants on blob keys.
+type Operation string
+
+const (
+	OpRead   Operation = "read"
+	OpWrite  Operation = "write"
+	OpDelete Operation = "delete"
+	OpList   Operation = "list"
+	// OpAny grants every operation.
+	OpAny Operation = "*"
+)
+
+var (
+	ErrInvalidScope = errors.New("invalid token scope")
+	ErrForbidden    = errors.New("operation not permitted by the token scopes")
+)
+
+// Scope grants an operation on the keys matching a pattern. A pattern ending in
+// "*" matches every key with the preceding prefix, "*" alone matches every key
+// and any other pattern only matches the exact key.
+type Scope struct {
+	Op      Operation
+	Pattern string
+
+	// exact scopes match the pattern literally, even when it ends with "*".
+	exact bool
+}
+
+// ParseScope parses a scope in the "operation:pattern" form, like "read:users/42/*".
+func ParseScope(value string) (Scope, error) {
+	op, pattern, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok || pattern == "" {
+		return Scope{}, fmt.Errorf("%w: %q is not in the operation:pattern form", ErrInvalidScope, value)
+	}
+
+	switch Operation(op) {
+	case OpRead, OpWrite, OpDelete, OpList, OpAny:
+	default:
+		return Scope{}, fmt.Errorf("%w: unknown operation %q", ErrInvalidScope, op)
+	}
+
+	if i := strings.Index(pattern, "*"); i >= 0 && i != len(pattern)-1 {
+		return Scope{}, fmt.Errorf("%w: %q may only end with *", ErrInvalidScope, value)
+	}
+
+	return Scope{Op: Operation(op), Pattern: pattern}, nil
+}
+
+func (s Scope) String() string {
+	return string(s.Op) + ":" + s.Pattern
+}
+
+func (s Scope) grants(op Operation) bool {
+	return s.Op == OpAny || s.Op == op
+}
+
+func (s Scope) matches(key string) bool {
+	if prefix, ok := strings.CutSuffix(s.Pattern, "*"); ok && !s.exact {
+		return strings.HasPrefix(key, prefix)
+	}
+
+	return s.Pattern == key
+}
+
+// overlaps reports whether the pattern matches any key starting with prefix.
+func (s Scope) overlaps(prefix string) bool {
+	if base, ok := strings.CutSuffix(s.Pattern, "*"); ok && !s.exact {
+		return strings.HasPrefix(prefix, base) || strings.HasPrefix(base, prefix)
+	}
+
+	return strings.HasPrefix(s.Pattern, prefix)
+}
+
+// Principal is the identity behind a validated token.
+type Principal struct {
+	Name   string
+	Scopes []Scope
+}
+
+// FullAccess returns a principal allowed to run every operation on every key.
+func FullAccess(name string) *Principal {
+	return &Principal{Name: name, Scopes: []Scope{{Op: OpAny, Pattern: "*"}}}
+}
+
+// KeyPrincipal returns a principal that may only run op on exactly one key, like
+// the holder of a share link.
+func KeyPrincipal(name string, op Operation, key string) *Principal {
+	return &Principal{Name: name, Scopes: []Scope{{Op: op, Pattern: key, exact: true}}}
+}
+
+// NewPrincipal parses the scopes of a principal.
+func NewPrincipal(name string, scopes []string) (*Principal, error) {
+	p := &Principal{Name: name}
+	for _, value := range scopes {
+		scope, err := ParseScope(value)
+		if err != nil {
+			return nil, err
+		}
+		p.Scopes = append(p.Scopes, scope)
+	}
+
+	return p, nil
+}
+
+// Allows reports whether the principal may run op on key.
+func (p *Principal) Allows(op Operation, key string) bool {
+	for _, scope := range p.Scopes {
+		if scope.grants(op) && scope.matches(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsUnder reports whether the principal may run op on at least some of the
+// keys starting with prefix.
+func (p *Principal) AllowsUnder(op Operation, prefix string) bool {
+	for _, scope := range p.Scopes {
+		if scope.grants(op) && scope.overlaps(prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the principal of the request.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored by WithPrincipal.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Allowed reports whether the principal in the context may run op on key.
+// Contexts without a principal are denied, so every entry point has to put one
+// there, like the API token middleware or a verified share link.
+func Allowed(ctx context.Context, op Operation, key string) bool {
+	p, ok := PrincipalFromContext(ctx)
+	return ok && p.Allows(op, key)
+}
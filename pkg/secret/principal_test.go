@@ -0,0 +1,73 @@
+package secret_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timgluz/blobber/pkg/secret"
+)
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    secret.Scope
+		wantErr bool
+	}{
+		{name: "prefix", value: "read:users/42/*", want: secret.Scope{Op: secret.OpRead, Pattern: "users/42/*"}},
+		{name: "exact key", value: "write:reports/q3.pdf", want: secret.Scope{Op: secret.OpWrite, Pattern: "reports/q3.pdf"}},
+		{name: "any operation", value: "*:*", want: secret.Scope{Op: secret.OpAny, Pattern: "*"}},
+		{name: "missing pattern", value: "read:", wantErr: true},
+		{name: "missing operation", value: "users/42/*", wantErr: true},
+		{name: "unknown operation", value: "admin:*", wantErr: true},
+		{name: "inner wildcard", value: "read:users/*/avatar.png", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := secret.ParseScope(tt.value)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, secret.ErrInvalidScope)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, scope)
+		})
+	}
+}
+
+func TestPrincipal_Allows(t *testing.T) {
+	principal, err := secret.NewPrincipal("user-42", []string{"read:users/42/*", "*:uploads/*"})
+	require.NoError(t, err)
+
+	assert.True(t, principal.Allows(secret.OpRead, "users/42/avatar.png"))
+	assert.False(t, principal.Allows(secret.OpWrite, "users/42/avatar.png"))
+	assert.False(t, principal.Allows(secret.OpRead, "users/420/avatar.png"))
+	assert.True(t, principal.Allows(secret.OpDelete, "uploads/tmp.bin"))
+
+	assert.True(t, principal.AllowsUnder(secret.OpRead, "users/"))
+	assert.True(t, principal.AllowsUnder(secret.OpRead, "users/42/docs/"))
+	assert.False(t, principal.AllowsUnder(secret.OpRead, "users/7/"))
+
+	full := secret.FullAccess("admin")
+	assert.True(t, full.Allows(secret.OpDelete, "anything"))
+}
+
+func TestKeyPrincipal_OnlyAllowsItsKey(t *testing.T) {
+	principal := secret.KeyPrincipal("share-link", secret.OpRead, "reports/*")
+
+	assert.True(t, principal.Allows(secret.OpRead, "reports/*"))
+	assert.False(t, principal.Allows(secret.OpRead, "reports/q3.pdf"))
+	assert.False(t, principal.Allows(secret.OpWrite, "reports/*"))
+}
+
+func TestAllowed_DeniesWithoutPrincipal(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, secret.Allowed(ctx, secret.OpRead, "reports/q3.pdf"))
+
+	ctx = secret.WithPrincipal(ctx, secret.FullAccess("admin"))
+	assert.True(t, secret.Allowed(ctx, secret.OpRead, "reports/q3.pdf"))
+}
@@ -0,0 +1,197 @@
+package secret
+
+import (
+	"context"
+	"io"
+
+	"github.com/timgluz/blobber/pkg/blobstore"
+)
+
+// ScopedStore enforces the scopes of the principal in the request context on
+// every call to the wrapped store. Forbidden calls, and calls without a
+// principal, fail with ErrForbidden before reaching the store, and lists only
+// return what the principal may list. Every method delegates explicitly, so a
+// new BlobStore method does not compile until it is scoped.
+type ScopedStore struct {
+	store blobstore.BlobStore
+}
+
+var _ blobstore.BlobStore = (*ScopedStore)(nil)
+
+func NewScopedStore(store blobstore.BlobStore) *ScopedStore {
+	return &ScopedStore{store: store}
+}
+
+// Ping checks the backend and is not tied to any key.
+func (s *ScopedStore) Ping(ctx context.Context) error {
+	return s.store.Ping(ctx)
+}
+
+func (s *ScopedStore) List(ctx context.Context, prefix string) ([]string, error) {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return nil, ErrForbidden
+	}
+
+	keys, err := s.store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if p.Allows(OpList, key) {
+			allowed = append(allowed, key)
+		}
+	}
+
+	return allowed, nil
+}
+
+// ListPage filters the page after it was fetched, so pages may hold fewer than
+// opts.Limit entries while the cursor still advances through the whole listing.
+func (s *ScopedStore) ListPage(ctx context.Context, opts blobstore.ListOptions) (blobstore.ListResult, error) {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return blobstore.ListResult{}, ErrForbidden
+	}
+
+	if !p.AllowsUnder(OpList, opts.Prefix) {
+		return blobstore.ListResult{}, nil
+	}
+
+	page, err := s.store.ListPage(ctx, opts)
+	if err != nil {
+		return page, err
+	}
+
+	items := make([]blobstore.BlobInfo, 0, len(page.Items))
+	for _, item := range page.Items {
+		if p.Allows(OpList, item.Key) {
+			items = append(items, item)
+		}
+	}
+	page.Items = items
+
+	var prefixes []string
+	for _, prefix := range page.Prefixes {
+		if p.AllowsUnder(OpList, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	page.Prefixes = prefixes
+
+	return page, nil
+}
+
+func (s *ScopedStore) Has(ctx context.Context, key string) error {
+	if !Allowed(ctx, OpRead, key) {
+		return ErrForbidden
+	}
+
+	return s.store.Has(ctx, key)
+}
+
+func (s *ScopedStore) Stat(ctx context.Context, key string) (blobstore.BlobInfo, error) {
+	if !Allowed(ctx, OpRead, key) {
+		return blobstore.BlobInfo{}, ErrForbidden
+	}
+
+	return s.store.Stat(ctx, key)
+}
+
+func (s *ScopedStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if !Allowed(ctx, OpRead, key) {
+		return nil, ErrForbidden
+	}
+
+	return s.store.Get(ctx, key)
+}
+
+func (s *ScopedStore) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !Allowed(ctx, OpRead, key) {
+		return nil, ErrForbidden
+	}
+
+	return s.store.GetReader(ctx, key)
+}
+
+func (s *ScopedStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if !Allowed(ctx, OpRead, key) {
+		return nil, ErrForbidden
+	}
+
+	return s.store.GetRange(ctx, key, offset, length)
+}
+
+func (s *ScopedStore) Put(ctx context.Context, key string, data []byte) error {
+	if !Allowed(ctx, OpWrite, key) {
+		return ErrForbidden
+	}
+
+	return s.store.Put(ctx, key, data)
+}
+
+func (s *ScopedStore) PutReader(ctx context.Context, key string, r io.Reader, size int64, opts blobstore.PutOptions) error {
+	if !Allowed(ctx, OpWrite, key) {
+		return ErrForbidden
+	}
+
+	return s.store.PutReader(ctx, key, r, size, opts)
+}
+
+func (s *ScopedStore) Delete(ctx context.Context, key string) error {
+	if !Allowed(ctx, OpDelete, key) {
+		return ErrForbidden
+	}
+
+	return s.store.Delete(ctx, key)
+}
+
+func (s *ScopedStore) DeleteWithOptions(ctx context.Context, key string, opts blobstore.DeleteOptions) error {
+	if !Allowed(ctx, OpDelete, key) {
+		return ErrForbidden
+	}
+
+	return s.store.DeleteWithOptions(ctx, key, opts)
+}
+
+// DeleteMany reports forbidden keys as failed and deletes the rest.
+func (s *ScopedStore) DeleteMany(ctx context.Context, keys []string) ([]blobstore.DeleteResult, error) {
+	results := make([]blobstore.DeleteResult, len(keys))
+	var allowed []string
+	var positions []int
+	for i, key := range keys {
+		results[i].Key = key
+		if !Allowed(ctx, OpDelete, key) {
+			results[i].Err = ErrForbidden
+			continue
+		}
+
+		allowed = append(allowed, key)
+		positions = append(positions, i)
+	}
+
+	if len(allowed) == 0 {
+		return results, nil
+	}
+
+	deleted, err := s.store.DeleteMany(ctx, allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, result := range deleted {
+		results[positions[i]] = result
+	}
+
+	return results, nil
+}
+
+func (s *ScopedStore) Copy(ctx context.Context, src, dst string) error {
+	if !Allowed(ctx, OpRead, src) || !Allowed(ctx, OpWrite, dst) {
+		return ErrForbidden
+	}
+
+	return s.store.Copy(ctx, src, dst)
+}
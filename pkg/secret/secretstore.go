@@ -1,14 +1,30 @@
 package secret
 
-import "context"
+import (
+	"context"
+	"net/http"
+)
 
 type AuthProviderType string
 
 const (
 	AuthProviderEnv  AuthProviderType = "env"
 	AuthProviderFile AuthProviderType = "file"
+	AuthProviderJWT  AuthProviderType = "jwt"
+	AuthProviderHMAC AuthProviderType = "hmac"
 )
 
 type SecretStore interface {
-	ValidateToken(ctx context.Context, token string) (bool, error)
+	// ValidateToken returns the principal of a valid token, or nil when the
+	// token is unknown, expired or revoked.
+	ValidateToken(ctx context.Context, token string) (*Principal, error)
+}
+
+// RequestAuthenticator is implemented by stores that authenticate the whole
+// request instead of a token, like signed requests.
+type RequestAuthenticator interface {
+	// AuthenticateRequest returns the principal of an authenticated request, or
+	// nil when it is not. The returned request replaces r for the next handler,
+	// and its body is closed by the middleware once the request is served.
+	AuthenticateRequest(r *http.Request) (*Principal, *http.Request, error)
 }
@@ -0,0 +1,72 @@
+package sharelink_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timgluz/blobber/pkg/sharelink"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSigner_SignAndVerify(t *testing.T) {
+	signer, err := sharelink.NewSigner(testSecret)
+	require.NoError(t, err)
+
+	now := time.Now()
+	link := sharelink.Link{
+		Key:       "reports/q3.pdf",
+		Method:    "GET",
+		Filename:  "Q3 report.pdf",
+		ExpiresAt: now.Add(time.Hour).Truncate(time.Second),
+	}
+
+	token, err := signer.Sign(link)
+	require.NoError(t, err)
+
+	verified, err := signer.Verify(token, now)
+	require.NoError(t, err)
+	assert.Equal(t, link.Key, verified.Key)
+	assert.Equal(t, link.Method, verified.Method)
+	assert.Equal(t, link.Filename, verified.Filename)
+	assert.True(t, link.ExpiresAt.Equal(verified.ExpiresAt))
+
+	_, err = signer.Verify(token, now.Add(2*time.Hour))
+	assert.ErrorIs(t, err, sharelink.ErrLinkExpired)
+}
+
+func TestSigner_RejectsTamperedTokens(t *testing.T) {
+	signer, err := sharelink.NewSigner(testSecret)
+	require.NoError(t, err)
+
+	token, err := signer.Sign(sharelink.Link{Key: "a.txt", Method: "GET", ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	other, err := sharelink.NewSigner([]byte(strings.Repeat("x", sharelink.MinSecretLength)))
+	require.NoError(t, err)
+	otherToken, err := other.Sign(sharelink.Link{Key: "b.txt", Method: "GET", ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	payload, signature, _ := strings.Cut(token, ".")
+	otherPayload, _, _ := strings.Cut(otherToken, ".")
+
+	for _, tampered := range []string{
+		"",
+		payload,
+		otherToken,
+		otherPayload + "." + signature,
+		payload + "." + signature[1:],
+		payload + ".!!!",
+	} {
+		_, err := signer.Verify(tampered, time.Now())
+		assert.ErrorIs(t, err, sharelink.ErrInvalidLink, tampered)
+	}
+}
+
+func TestNewSigner_RejectsShortSecrets(t *testing.T) {
+	_, err := sharelink.NewSigner([]byte("too short"))
+	assert.ErrorIs(t, err, sharelink.ErrNoValidSecret)
+}
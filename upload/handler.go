@@ -0,0 +1,470 @@
+// Package upload implements resumable uploads with the tus 1.0 protocol
+// (https://tus.io/protocols/resumable-upload), covering the core protocol and
+// the creation, termination and expiration extensions.
+package upload
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/timgluz/blobber/pkg/blobstore"
+	"github.com/timgluz/blobber/pkg/response"
+	"github.com/timgluz/blobber/pkg/secret"
+)
+
+const (
+	TusVersion    = "1.0.0"
+	TusExtensions = "creation,termination,expiration"
+
+	// DefaultExpireAfter is how long an upload may take before it is removed.
+	DefaultExpireAfter = 24 * time.Hour
+
+	// offsetContentType is the required Content-Type of PATCH requests.
+	offsetContentType = "application/offset+octet-stream"
+	// cleanupInterval is how often expired uploads are looked for.
+	cleanupInterval = time.Hour
+)
+
+var ErrNoUploadDir = errors.New("no upload directory configured")
+
+type Config struct {
+	// Dir holds the state of unfinished uploads, so they survive restarts.
+	Dir string `yaml:"dir"`
+	// MaxSize is the largest accepted upload in bytes; zero means unlimited.
+	MaxSize int64 `yaml:"max_size"`
+	// ExpireAfter is how long after its creation an upload and its partial
+	// content are kept; it defaults to 24 hours.
+	ExpireAfter time.Duration `yaml:"expire_after"`
+}
+
+type Handler struct {
+	config Config
+	store  blobstore.BlobStore
+	state  *stateStore
+	logger *slog.Logger
+
+	// locks serializes the requests on a single upload
+	locks sync.Map
+}
+
+func NewHandler(config Config, store blobstore.BlobStore, logger *slog.Logger) (*Handler, error) {
+	if strings.TrimSpace(config.Dir) == "" {
+		return nil, ErrNoUploadDir
+	}
+
+	if logger == nil {
+		return nil, blobstore.ErrNoValidLogger
+	}
+
+	if config.ExpireAfter <= 0 {
+		config.ExpireAfter = DefaultExpireAfter
+	}
+
+	state, err := newStateStore(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{config: config, store: secret.NewScopedStore(store), state: state, logger: logger}, nil
+}
+
+// RunCleanup periodically removes expired uploads until the context is cancelled.
+func (h *Handler) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := h.RemoveExpired()
+		if err != nil {
+			h.logger.Error("Removing expired uploads failed", slog.Any("error", err))
+		} else if removed > 0 {
+			h.logger.Info("Removed expired uploads", slog.Int("count", removed))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RemoveExpired removes the state and partial content of expired uploads and
+// returns how many were removed.
+func (h *Handler) RemoveExpired() (int, error) {
+	ids, err := h.state.expired(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, id := range ids {
+		unlock := h.lock(id)
+		err := h.state.remove(id)
+		// dropped while locked, so waiting requests retry with a fresh mutex
+		h.locks.Delete(id)
+		unlock()
+
+		if err != nil {
+			h.logger.Error("Failed to remove expired upload", slog.String("id", id), slog.String("error", err.Error()))
+			continue
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// HandleUploads serves the upload collection: creation and server discovery.
+func (h *Handler) HandleUploads(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodOptions:
+		h.options(w)
+	case http.MethodPost:
+		if h.checkVersion(w, r) {
+			h.createUpload(w, r)
+		}
+	default:
+		response.RenderErrorJSON(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle serves a single upload.
+func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		h.options(w)
+		return
+	}
+
+	if !h.checkVersion(w, r) {
+		return
+	}
+
+	id := r.PathValue("id")
+	if !validUploadID(id) {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		h.uploadOffset(w, r, id)
+	case http.MethodPatch:
+		defer h.lock(id)()
+		h.appendUpload(w, r, id)
+	case http.MethodDelete:
+		defer h.lock(id)()
+		h.terminateUpload(w, r, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// lock serializes the writes to a single upload and returns the unlock function.
+// Entries are dropped while locked when an upload is removed, so a request that
+// waited on a dropped mutex retries with the current one.
+func (h *Handler) lock(id string) func() {
+	for {
+		value, _ := h.locks.LoadOrStore(id, &sync.Mutex{})
+		mu := value.(*sync.Mutex)
+		mu.Lock()
+
+		if current, ok := h.locks.Load(id); ok && current == value {
+			return mu.Unlock
+		}
+		mu.Unlock()
+	}
+}
+
+func (h *Handler) options(w http.ResponseWriter) {
+	header := w.Header()
+	header.Set("Tus-Resumable", TusVersion)
+	header.Set("Tus-Version", TusVersion)
+	header.Set("Tus-Extension", TusExtensions)
+	if h.config.MaxSize > 0 {
+		header.Set("Tus-Max-Size", strconv.FormatInt(h.config.MaxSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkVersion rejects requests for other protocol versions with 412.
+func (h *Handler) checkVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", TusVersion)
+	if r.Header.Get("Tus-Resumable") == TusVersion {
+		return true
+	}
+
+	w.Header().Set("Tus-Version", TusVersion)
+	http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+	return false
+}
+
+// createUpload reserves a new upload. The target key is taken from the "key"
+// or "filename" metadata and the content type from the "filetype" metadata.
+func (h *Handler) createUpload(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Upload-Length must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	if h.config.MaxSize > 0 && length > h.config.MaxSize {
+		http.Error(w, "Upload exceeds Tus-Max-Size", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	rawMetadata := r.Header.Get("Upload-Metadata")
+	metadata, err := parseMetadata(rawMetadata)
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+
+	rawKey := metadata["key"]
+	if rawKey == "" {
+		rawKey = metadata["filename"]
+	}
+
+	key := blobstore.NormalizeKey(rawKey)
+	if err := blobstore.ValidateKey(key); err != nil {
+		http.Error(w, "Upload-Metadata must name a valid key or filename: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !secret.Allowed(r.Context(), secret.OpWrite, key) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	contentType := metadata["filetype"]
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		h.logger.Error("Failed to generate upload ID", slog.String("error", err.Error()))
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	info := uploadInfo{
+		ID:          id,
+		Key:         key,
+		Length:      length,
+		ContentType: contentType,
+		Metadata:    rawMetadata,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(h.config.ExpireAfter),
+	}
+	if err := h.state.create(info); err != nil {
+		h.logger.Error("Failed to create upload", slog.String("key", key), slog.String("error", err.Error()))
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("Upload created", slog.String("id", id), slog.String("key", key), slog.Int64("length", length))
+
+	// an empty upload is complete right away
+	if length == 0 {
+		if err := h.finish(r, info); err != nil {
+			http.Error(w, "Failed to store upload", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if length > 0 {
+		setExpires(w, info)
+	}
+	w.Header().Set("Location", path.Join(r.URL.Path, id))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handler) uploadOffset(w http.ResponseWriter, r *http.Request, id string) {
+	info, offset, ok := h.loadUpload(w, r, id)
+	if !ok {
+		return
+	}
+
+	header := w.Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	if info.Metadata != "" {
+		header.Set("Upload-Metadata", info.Metadata)
+	}
+	setExpires(w, info)
+	w.WriteHeader(http.StatusOK)
+}
+
+// appendUpload appends the request body at Upload-Offset. Once all bytes were
+// received, the content is written to the blob store.
+func (h *Handler) appendUpload(w http.ResponseWriter, r *http.Request, id string) {
+	defer r.Body.Close()
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != offsetContentType {
+		http.Error(w, "Content-Type must be "+offsetContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	clientOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || clientOffset < 0 {
+		http.Error(w, "Upload-Offset must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	info, offset, ok := h.loadUpload(w, r, id)
+	if !ok {
+		return
+	}
+
+	if clientOffset != offset {
+		http.Error(w, fmt.Sprintf("Upload-Offset %d does not match the current offset %d", clientOffset, offset), http.StatusConflict)
+		return
+	}
+
+	if r.ContentLength > info.Length-offset {
+		http.Error(w, "Request body exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !info.Completed && offset < info.Length {
+		written, err := h.state.appendData(id, r.Body, info.Length-offset)
+		offset += written
+		if err != nil {
+			h.logger.Warn("Upload interrupted", slog.String("id", id), slog.Int64("offset", offset), slog.String("error", err.Error()))
+			w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+			http.Error(w, "Failed to receive upload content", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// bodies of unknown length are only found to be too long once the upload is
+	// full; the content is still stored, so no further PATCH is needed
+	n, _ := r.Body.Read(make([]byte, 1))
+	overrun := n > 0
+
+	if !info.Completed && offset == info.Length {
+		if err := h.finish(r, info); err != nil {
+			http.Error(w, "Failed to store upload", http.StatusInternalServerError)
+			return
+		}
+		info.Completed = true
+	}
+
+	setExpires(w, info)
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if overrun {
+		http.Error(w, "Request body exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finish writes the received content to the blob store. When that fails, the
+// state is kept and a PATCH without content at the final offset retries.
+func (h *Handler) finish(r *http.Request, info uploadInfo) error {
+	data, err := h.state.openData(info.ID)
+	if err != nil {
+		h.logger.Error("Failed to open upload", slog.String("id", info.ID), slog.String("error", err.Error()))
+		return err
+	}
+	defer data.Close()
+
+	opts := blobstore.PutOptions{ContentType: info.ContentType}
+	if err := h.store.PutReader(r.Context(), info.Key, data, info.Length, opts); err != nil {
+		h.logger.Error("Failed to store upload", slog.String("id", info.ID), slog.String("key", info.Key), slog.String("error", err.Error()))
+		return err
+	}
+
+	if err := h.state.complete(info); err != nil {
+		h.logger.Error("Failed to mark upload as completed", slog.String("id", info.ID), slog.String("error", err.Error()))
+	}
+
+	h.logger.Info("Upload completed", slog.String("id", info.ID), slog.String("key", info.Key))
+	return nil
+}
+
+func (h *Handler) terminateUpload(w http.ResponseWriter, r *http.Request, id string) {
+	if _, _, ok := h.loadUpload(w, r, id); !ok {
+		return
+	}
+
+	if err := h.state.remove(id); err != nil {
+		h.logger.Error("Failed to terminate upload", slog.String("id", id), slog.String("error", err.Error()))
+		http.Error(w, "Failed to terminate upload", http.StatusInternalServerError)
+		return
+	}
+
+	h.locks.Delete(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadUpload loads the upload state, answering 404 for unknown uploads, 410 for
+// expired ones and 403 when the token may not write the target key.
+func (h *Handler) loadUpload(w http.ResponseWriter, r *http.Request, id string) (uploadInfo, int64, bool) {
+	info, offset, err := h.state.load(id, time.Now())
+	if err != nil {
+		if errors.Is(err, errUploadNotFound) {
+			h.locks.Delete(id)
+			http.Error(w, "Upload not found", http.StatusNotFound)
+			return info, 0, false
+		}
+
+		if errors.Is(err, errUploadExpired) {
+			http.Error(w, "Upload expired", http.StatusGone)
+			return info, 0, false
+		}
+
+		h.logger.Error("Failed to load upload", slog.String("id", id), slog.String("error", err.Error()))
+		http.Error(w, "Failed to load upload", http.StatusInternalServerError)
+		return info, 0, false
+	}
+
+	if !secret.Allowed(r.Context(), secret.OpWrite, info.Key) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return info, 0, false
+	}
+
+	return info, offset, true
+}
+
+// setExpires announces when an unfinished upload expires.
+func setExpires(w http.ResponseWriter, info uploadInfo) {
+	if !info.Completed {
+		w.Header().Set("Upload-Expires", info.ExpiresAt.Format(http.TimeFormat))
+	}
+}
+
+// parseMetadata decodes an Upload-Metadata header: comma separated pairs of a
+// key and an optional base64 encoded value.
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for pair := range strings.SplitSeq(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,291 @@
+package upload_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timgluz/blobber/pkg/blobstore"
+	"github.com/timgluz/blobber/pkg/secret"
+	"github.com/timgluz/blobber/upload"
+)
+
+const testHMACSecret = "0123456789abcdef0123456789abcdef"
+
+func TestHandler_ResumableUpload(t *testing.T) {
+	store := newTestStore(t)
+	dir := t.TempDir()
+	server := newTestServer(t, upload.Config{Dir: dir}, store)
+
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("videos/clip.mp4")) +
+		",filetype " + base64.StdEncoding.EncodeToString([]byte("video/mp4"))
+	res := doTusRequest(t, server, http.MethodPost, "/uploads", nil, http.Header{
+		"Upload-Length":   {"11"},
+		"Upload-Metadata": {metadata},
+	})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	location := res.Header.Get("Location")
+	require.True(t, strings.HasPrefix(location, "/uploads/"))
+
+	res = doTusRequest(t, server, http.MethodPatch, location, strings.NewReader("hello "), http.Header{
+		"Content-Type":  {"application/offset+octet-stream"},
+		"Upload-Offset": {"0"},
+	})
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "6", res.Header.Get("Upload-Offset"))
+
+	// the state survives a restart
+	server = newTestServer(t, upload.Config{Dir: dir}, store)
+
+	res = doTusRequest(t, server, http.MethodHead, location, nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "6", res.Header.Get("Upload-Offset"))
+	assert.Equal(t, "11", res.Header.Get("Upload-Length"))
+	assert.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+
+	res = doTusRequest(t, server, http.MethodPatch, location, strings.NewReader("world"), http.Header{
+		"Content-Type":  {"application/offset+octet-stream"},
+		"Upload-Offset": {"0"},
+	})
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+
+	res = doTusRequest(t, server, http.MethodPatch, location, strings.NewReader("world"), http.Header{
+		"Content-Type":  {"application/offset+octet-stream"},
+		"Upload-Offset": {"6"},
+	})
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "11", res.Header.Get("Upload-Offset"))
+
+	data, err := store.Get(context.Background(), "videos/clip.mp4")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	info, err := store.Stat(context.Background(), "videos/clip.mp4")
+	require.NoError(t, err)
+	assert.Equal(t, "video/mp4", info.ContentType)
+
+	res = doTusRequest(t, server, http.MethodHead, location, nil, nil)
+	assert.Equal(t, "11", res.Header.Get("Upload-Offset"))
+
+	res = doTusRequest(t, server, http.MethodDelete, location, nil, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res = doTusRequest(t, server, http.MethodHead, location, nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestHandler_RejectsChunksLongerThanTheUpload(t *testing.T) {
+	store := newTestStore(t)
+	server := newTestServer(t, upload.Config{Dir: t.TempDir()}, store)
+	filename := "filename " + base64.StdEncoding.EncodeToString([]byte("a.txt"))
+	patch := http.Header{"Content-Type": {"application/offset+octet-stream"}, "Upload-Offset": {"0"}}
+
+	res := doTusRequest(t, server, http.MethodPost, "/uploads", nil, http.Header{"Upload-Length": {"5"}, "Upload-Metadata": {filename}})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	location := res.Header.Get("Location")
+
+	// a declared length beyond the upload is rejected before anything is written
+	res = doTusRequest(t, server, http.MethodPatch, location, strings.NewReader("hello world"), patch)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	res = doTusRequest(t, server, http.MethodHead, location, nil, nil)
+	assert.Equal(t, "0", res.Header.Get("Upload-Offset"))
+
+	// a chunked body is only found to be too long once the upload is full, which is stored anyway
+	res = doTusRequest(t, server, http.MethodPatch, location, io.MultiReader(strings.NewReader("hello world")), patch)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	assert.Equal(t, "5", res.Header.Get("Upload-Offset"))
+
+	data, err := store.Get(context.Background(), "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestHandler_CreateValidation(t *testing.T) {
+	server := newTestServer(t, upload.Config{Dir: t.TempDir(), MaxSize: 10}, newTestStore(t))
+	filename := "filename " + base64.StdEncoding.EncodeToString([]byte("a.txt"))
+
+	res := doTusRequest(t, server, http.MethodPost, "/uploads", nil, http.Header{"Upload-Length": {"11"}, "Upload-Metadata": {filename}})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+
+	res = doTusRequest(t, server, http.MethodPost, "/uploads", nil, http.Header{"Upload-Length": {"5"}})
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "a key or filename is required")
+
+	res = doTusRequest(t, server, http.MethodPost, "/uploads", nil, http.Header{"Upload-Metadata": {filename}})
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = doTusRequest(t, server, http.MethodPost, "/uploads", nil, http.Header{
+		"Upload-Length":   {"5"},
+		"Upload-Metadata": {filename},
+		"Tus-Resumable":   {"0.2.2"},
+	})
+	assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+	assert.Equal(t, upload.TusVersion, res.Header.Get("Tus-Version"))
+
+	res = doTusRequest(t, server, http.MethodOptions, "/uploads", nil, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, upload.TusExtensions, res.Header.Get("Tus-Extension"))
+	assert.Equal(t, "10", res.Header.Get("Tus-Max-Size"))
+}
+
+func TestHandler_DiscardsContentNotMatchingSignedHash(t *testing.T) {
+	t.Setenv("TEST_HMAC_SECRET", testHMACSecret)
+	auth, err := secret.NewHMACSecretStore(secret.HMACConfig{
+		Keys: []secret.HMACKey{{ID: "uploader", SecretEnvVar: "TEST_HMAC_SECRET"}},
+	}, newTestLogger())
+	require.NoError(t, err)
+
+	handler, err := upload.NewHandler(upload.Config{Dir: t.TempDir()}, newTestStore(t), newTestLogger())
+	require.NoError(t, err)
+	server := httptest.NewServer(secret.NewAPITokenMiddleware(auth, newTestLogger()).Handler(newTestMux(handler)))
+	t.Cleanup(server.Close)
+
+	filename := "filename " + base64.StdEncoding.EncodeToString([]byte("a.txt"))
+	res := doSignedTusRequest(t, server, http.MethodPost, "/uploads", "", "", http.Header{"Upload-Length": {"11"}, "Upload-Metadata": {filename}})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	location := res.Header.Get("Location")
+
+	patch := http.Header{"Content-Type": {"application/offset+octet-stream"}, "Upload-Offset": {"0"}}
+	res = doSignedTusRequest(t, server, http.MethodPatch, location, "hello ", "jello ", patch)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// the chunk is rejected before it reaches the upload
+	res = doSignedTusRequest(t, server, http.MethodHead, location, "", "", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "0", res.Header.Get("Upload-Offset"))
+
+	res = doSignedTusRequest(t, server, http.MethodPatch, location, "hello ", "hello ", patch)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "6", res.Header.Get("Upload-Offset"))
+}
+
+func TestHandler_ExpiresUnfinishedUploads(t *testing.T) {
+	dir := t.TempDir()
+	handler, err := upload.NewHandler(upload.Config{Dir: dir, ExpireAfter: 50 * time.Millisecond}, newTestStore(t), newTestLogger())
+	require.NoError(t, err)
+	server := newTestServerWithHandler(t, handler)
+
+	filename := "filename " + base64.StdEncoding.EncodeToString([]byte("a.txt"))
+	res := doTusRequest(t, server, http.MethodPost, "/uploads", nil, http.Header{"Upload-Length": {"11"}, "Upload-Metadata": {filename}})
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	location := res.Header.Get("Location")
+
+	expires, err := http.ParseTime(res.Header.Get("Upload-Expires"))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), expires, 2*time.Second)
+
+	removed, err := handler.RemoveExpired()
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+
+	time.Sleep(100 * time.Millisecond)
+
+	res = doTusRequest(t, server, http.MethodHead, location, nil, nil)
+	assert.Equal(t, http.StatusGone, res.StatusCode)
+
+	removed, err = handler.RemoveExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	res = doTusRequest(t, server, http.MethodHead, location, nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func newTestStore(t *testing.T) *blobstore.MemoryBlobStore {
+	t.Helper()
+
+	store, err := blobstore.NewMemoryBlobStore(blobstore.MemoryConfig{}, newTestLogger())
+	require.NoError(t, err)
+
+	return store
+}
+
+func newTestServer(t *testing.T, config upload.Config, store blobstore.BlobStore) *httptest.Server {
+	t.Helper()
+
+	handler, err := upload.NewHandler(config, store, newTestLogger())
+	require.NoError(t, err)
+
+	return newTestServerWithHandler(t, handler)
+}
+
+// newTestServerWithHandler serves the upload routes with a full access
+// principal in the request context, like the API token middleware.
+func newTestServerWithHandler(t *testing.T, handler *upload.Handler) *httptest.Server {
+	t.Helper()
+
+	principal := secret.FullAccess("test")
+	mux := newTestMux(handler)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(secret.WithPrincipal(r.Context(), principal)))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newTestMux(handler *upload.Handler) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/uploads", handler.HandleUploads)
+	mux.HandleFunc("/uploads/{id}", handler.Handle)
+
+	return mux
+}
+
+// doTusRequest sends a request with the Tus-Resumable header, unless header overrides it.
+func doTusRequest(t *testing.T, server *httptest.Server, method, path string, body io.Reader, header http.Header) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+path, body)
+	require.NoError(t, err)
+
+	req.Header.Set("Tus-Resumable", upload.TusVersion)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	res, err := server.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+// doSignedTusRequest signs a tus request over signedBody and sends body instead.
+func doSignedTusRequest(t *testing.T, server *httptest.Server, method, path, signedBody, body string, header http.Header) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(signedBody))
+	require.NoError(t, err)
+
+	req.Header.Set("Tus-Resumable", upload.TusVersion)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	require.NoError(t, secret.SignRequest(req, "uploader", []byte(testHMACSecret)))
+	req.Body = io.NopCloser(strings.NewReader(body))
+	req.GetBody = nil
+
+	res, err := server.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+func newTestLogger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
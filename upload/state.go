@@ -0,0 +1,215 @@
+package upload
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	errUploadNotFound = errors.New("upload not found")
+	errUploadExpired  = errors.New("upload expired")
+)
+
+// uploadInfo is persisted next to the partial content of every upload.
+type uploadInfo struct {
+	ID          string    `json:"id"`
+	Key         string    `json:"key"`
+	Length      int64     `json:"length"`
+	ContentType string    `json:"content_type,omitempty"`
+	Metadata    string    `json:"metadata,omitempty"` // raw Upload-Metadata header
+	CreatedAt   time.Time `json:"created_at"`
+	// ExpiresAt is when the upload and its partial content are removed.
+	ExpiresAt time.Time `json:"expires_at"`
+	// Completed is set once the content was written to the blob store and the
+	// partial content was removed.
+	Completed bool `json:"completed,omitempty"`
+}
+
+// stateStore keeps the state of uploads in a directory, as <id>.json with the
+// upload info and <id>.bin with the content received so far. The offset of an
+// upload is the size of its content file, so it survives restarts and crashes.
+type stateStore struct {
+	dir string
+}
+
+func newStateStore(dir string) (*stateStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &stateStore{dir: dir}, nil
+}
+
+// newUploadID returns a random ID that is safe to use as a file name.
+func newUploadID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id[:]), nil
+}
+
+// validUploadID reports whether id has the format returned by newUploadID.
+func validUploadID(id string) bool {
+	decoded, err := hex.DecodeString(id)
+	return err == nil && len(decoded) == 16
+}
+
+func (s *stateStore) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *stateStore) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+func (s *stateStore) create(info uploadInfo) error {
+	data, err := os.Create(s.dataPath(info.ID))
+	if err != nil {
+		return err
+	}
+	data.Close()
+
+	return s.save(info)
+}
+
+// save replaces the info file atomically.
+func (s *stateStore) save(info uploadInfo) error {
+	content, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.infoPath(info.ID) + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.infoPath(info.ID))
+}
+
+// load returns the upload info and the number of bytes received so far.
+// Expired uploads fail with errUploadExpired until they are removed.
+func (s *stateStore) load(id string, now time.Time) (uploadInfo, int64, error) {
+	info, err := s.readInfo(id)
+	if err != nil {
+		return info, 0, err
+	}
+
+	if now.After(info.ExpiresAt) {
+		return info, 0, errUploadExpired
+	}
+
+	if info.Completed {
+		return info, info.Length, nil
+	}
+
+	stat, err := os.Stat(s.dataPath(id))
+	if err != nil {
+		return info, 0, err
+	}
+
+	return info, stat.Size(), nil
+}
+
+func (s *stateStore) readInfo(id string) (uploadInfo, error) {
+	var info uploadInfo
+	if !validUploadID(id) {
+		return info, errUploadNotFound
+	}
+
+	content, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return info, errUploadNotFound
+	}
+	if err != nil {
+		return info, err
+	}
+
+	if err := json.Unmarshal(content, &info); err != nil {
+		return info, err
+	}
+
+	return info, nil
+}
+
+// expired returns the IDs of the uploads that expired before now.
+func (s *stateStore) expired(now time.Time) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !validUploadID(id) {
+			continue
+		}
+
+		info, err := s.readInfo(id)
+		if err != nil {
+			continue
+		}
+
+		if now.After(info.ExpiresAt) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// appendData appends at most limit bytes from r to the content of the upload
+// and returns how many bytes were written. Bytes written before a read error
+// are kept, so the client can resume from there.
+func (s *stateStore) appendData(id string, r io.Reader, limit int64) (int64, error) {
+	file, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	written, copyErr := io.Copy(file, io.LimitReader(r, limit))
+	if err := file.Sync(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	return written, copyErr
+}
+
+func (s *stateStore) openData(id string) (*os.File, error) {
+	return os.Open(s.dataPath(id))
+}
+
+// complete marks the upload as stored and drops its partial content.
+func (s *stateStore) complete(info uploadInfo) error {
+	info.Completed = true
+	if err := s.save(info); err != nil {
+		return err
+	}
+
+	return os.Remove(s.dataPath(info.ID))
+}
+
+func (s *stateStore) remove(id string) error {
+	if err := os.Remove(s.infoPath(id)); err != nil {
+		return err
+	}
+
+	// the content of completed uploads is already gone
+	if err := os.Remove(s.dataPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}